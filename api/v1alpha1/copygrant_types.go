@@ -0,0 +1,78 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CopyGrantSpec defines which namespaces may copy which Resources of the namespace of the CopyGrant
+type CopyGrantSpec struct {
+	// The From namespaces whose CopyResources may copy the Resources
+	// +kubebuilder:validation:MinItems=1
+	From []CopyGrantFrom `json:"from"`
+
+	// The To Resources which may be copied
+	// +kubebuilder:validation:MinItems=1
+	To []CopyGrantTo `json:"to"`
+}
+
+// CopyGrantFrom describes a namespace whose CopyResources may copy Resources
+type CopyGrantFrom struct {
+	// The Namespace of the CopyResources, an exact name or a glob like team-*
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+}
+
+// CopyGrantTo describes the Resources which may be copied
+type CopyGrantTo struct {
+	// The Group of the Resources, empty for the core API group
+	// +kubebuilder:validation:Optional
+	Group string `json:"group,omitempty"`
+
+	// The Kind of the Resources, an exact kind or a glob like *
+	// +kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+
+	// The Name of the Resource, an exact name or a glob like shared-*. All Resources of Kind may be copied if empty
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CopyGrant permits CopyResources of other namespaces to copy Resources of its namespace
+type CopyGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CopyGrantSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CopyGrantList contains a list of CopyGrant
+type CopyGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CopyGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CopyGrant{}, &CopyGrantList{})
+}
@@ -0,0 +1,84 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CopyPolicySpec restricts what may be copied where.
+// A copy is denied if any Deny rule of any CopyPolicy matches it. If any CopyPolicy has Allow rules,
+// a copy is only permitted if an Allow rule of any CopyPolicy matches it.
+// Copies by annotation always need a matching Allow rule, rules for Annotations don't restrict CopyResources.
+type CopyPolicySpec struct {
+	// The Allow rules permit matching copies
+	// +kubebuilder:validation:Optional
+	Allow []CopyPolicyRule `json:"allow,omitempty"`
+
+	// The Deny rules forbid matching copies, they take precedence over Allow rules
+	// +kubebuilder:validation:Optional
+	Deny []CopyPolicyRule `json:"deny,omitempty"`
+}
+
+// CopyPolicyRule matches a copy if all of its fields match, empty fields match everything.
+// All list fields hold exact names or globs like openshift-*
+type CopyPolicyRule struct {
+	// The SourceNamespaces of the source Resources
+	// +kubebuilder:validation:Optional
+	SourceNamespaces []string `json:"sourceNamespaces,omitempty"`
+
+	// The TargetNamespaces of the target Resources
+	// +kubebuilder:validation:Optional
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+
+	// The Kinds of the source and target Resources
+	// +kubebuilder:validation:Optional
+	Kinds []string `json:"kinds,omitempty"`
+
+	// The Names of the source Resources
+	// +kubebuilder:validation:Optional
+	Names []string `json:"names,omitempty"`
+
+	// Annotations restricts the rule to copies requested by the copy-to annotations of source Resources
+	// +kubebuilder:validation:Optional
+	Annotations bool `json:"annotations,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CopyPolicy is the Schema for the cluster wide restrictions of CopyResources
+type CopyPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CopyPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CopyPolicyList contains a list of CopyPolicy
+type CopyPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CopyPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CopyPolicy{}, &CopyPolicyList{})
+}
@@ -23,33 +23,288 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// DeletionPolicy describes what happens to the target Resources when the CopyResource is deleted
+// +kubebuilder:validation:Enum=Orphan;Delete
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyOrphan keeps the target Resources when the CopyResource is deleted
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+	// DeletionPolicyDelete deletes the target Resources before the CopyResource is deleted
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
+// ConflictPolicy describes how an existing target Resource which was not written by the CopyResource is treated
+// +kubebuilder:validation:Enum=Fail;Adopt;Overwrite
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyFail never writes an existing target Resource and reports a Conflict instead
+	ConflictPolicyFail ConflictPolicy = "Fail"
+	// ConflictPolicyAdopt takes over an existing target Resource which is not managed by another CopyResource
+	ConflictPolicyAdopt ConflictPolicy = "Adopt"
+	// ConflictPolicyOverwrite takes over any existing target Resource
+	ConflictPolicyOverwrite ConflictPolicy = "Overwrite"
+)
+
+// MergeStrategy describes how keys of several sources are merged into one target Resource
+// +kubebuilder:validation:Enum=LastWins;FailOnCollision;Merge
+type MergeStrategy string
+
+const (
+	// MergeStrategyLastWins takes the value of the last source defining a key
+	MergeStrategyLastWins MergeStrategy = "LastWins"
+	// MergeStrategyFailOnCollision fails the copy if several sources define the same key
+	MergeStrategyFailOnCollision MergeStrategy = "FailOnCollision"
+	// MergeStrategyMerge merges the auths of docker configs and the certificates of PEM bundles, other keys are taken from the last source
+	MergeStrategyMerge MergeStrategy = "Merge"
+)
+
 // CopyResourceSpec defines the desired state of CopyResource
 type CopyResourceSpec struct {
-	// The Kind of the Resource you like to copy
+	// The APIVersion of the Resource you like to copy, defaults to v1
+	// +kubebuilder:validation:Optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// The Kind of the Resource you like to copy, any namespaced kind is supported
 	// +kubebuilder:validation:Required
-	// +kubebuilder:validation:Enum=Secret;ConfigMap
 	Kind string `json:"kind"`
 
-	// The MetaName of the Resource found in metadata.name
-	// +kubebuilder:validation:Required
-	MetaName string `json:"metaName"`
+	// The TargetKind of the target Resources, defaults to Kind.
+	// Secrets can be copied to ConfigMaps and ConfigMaps to Secrets, other kinds can't be converted
+	// +kubebuilder:validation:Optional
+	TargetKind string `json:"targetKind,omitempty"`
+
+	// The BinaryKeys of a Secret copied to binaryData of a ConfigMap instead of data, which only holds UTF-8 strings.
+	// The entries support the same patterns as IncludeKeys
+	// +kubebuilder:validation:Optional
+	BinaryKeys []string `json:"binaryKeys,omitempty"`
+
+	// The MetaName of the Resource found in metadata.name, either MetaName or Sources must be set
+	// +kubebuilder:validation:Optional
+	MetaName string `json:"metaName,omitempty"`
+
+	// The SourceNamespace of the source Resources, defaults to the namespace of the CopyResource.
+	// Resources of other namespaces are only copied if a CopyGrant in the SourceNamespace permits it
+	// +kubebuilder:validation:Optional
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+
+	// The Sources are merged into one target Resource, after the Resource named by MetaName if both are set
+	// +kubebuilder:validation:Optional
+	Sources []Source `json:"sources,omitempty"`
+
+	// The MergeStrategy defines how keys defined by several sources are merged, defaults to FailOnCollision
+	// +kubebuilder:validation:Optional
+	MergeStrategy MergeStrategy `json:"mergeStrategy,omitempty"`
 
 	// The TargetNamespace the Resource should be copied to
-	// +kubebuilder:validation:Required
-	TargetNamespace string `json:"targetNamespace"`
+	// +kubebuilder:validation:Optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// The TargetNamespaces the Resource should be copied to, in addition to TargetNamespace
+	// +kubebuilder:validation:Optional
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+
+	// The TargetNamespaceSelector selects the namespaces the Resource should be copied to, in addition to TargetNamespaces
+	// +kubebuilder:validation:Optional
+	TargetNamespaceSelector *metav1.LabelSelector `json:"targetNamespaceSelector,omitempty"`
 
 	// The TargetName the Resource should be named in TargetNamespace
 	// +kubebuilder:validation:Optional
 	TargetName string `json:"targetName"`
+
+	// The DeletionPolicy defines if the target Resources are kept (Orphan) or deleted (Delete) with the CopyResource, defaults to Orphan
+	// +kubebuilder:validation:Optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// The ConflictPolicy defines if an existing target Resource not written by this CopyResource is
+	// left untouched (Fail), taken over if not managed by another CopyResource (Adopt) or always taken over (Overwrite), defaults to Fail
+	// +kubebuilder:validation:Optional
+	ConflictPolicy ConflictPolicy `json:"conflictPolicy,omitempty"`
+
+	// The StripFields are removed from the target Resource in addition to status and the server owned metadata,
+	// each field is a dot separated path, e.g. spec.clusterIP
+	// +kubebuilder:validation:Optional
+	StripFields []string `json:"stripFields,omitempty"`
+
+	// The IncludeKeys select the keys of data, stringData and binaryData copied to the target Resource, defaults to all keys.
+	// Each entry is an exact key, a glob like tls.* or a regular expression enclosed in slashes like /^ca\.(crt|pem)$/
+	// +kubebuilder:validation:Optional
+	IncludeKeys []string `json:"includeKeys,omitempty"`
+
+	// The ExcludeKeys remove keys of data, stringData and binaryData from the target Resource, even if they are included.
+	// The entries support the same patterns as IncludeKeys
+	// +kubebuilder:validation:Optional
+	ExcludeKeys []string `json:"excludeKeys,omitempty"`
+
+	// The KeyMappings rename keys of data, stringData and binaryData in the target Resource after IncludeKeys and ExcludeKeys are applied.
+	// A source key can be mapped to several target keys, unmapped keys are copied unchanged
+	// +kubebuilder:validation:Optional
+	KeyMappings []KeyMapping `json:"keyMappings,omitempty"`
+
+	// The Transform renders keys of the target data from Go text/templates, mapping the target key to its template.
+	// The templates have access to all decoded source keys (.Data) and the source metadata (.Metadata)
+	// and replace copied keys of the same name. Missing source keys render empty. Only Secret and ConfigMap targets are supported
+	// +kubebuilder:validation:Optional
+	Transform map[string]string `json:"transform,omitempty"`
+}
+
+// Source is one of several Resources merged into one target Resource
+type Source struct {
+	// The MetaName of the Resource found in metadata.name
+	// +kubebuilder:validation:MinLength=1
+	MetaName string `json:"metaName"`
+
+	// The IncludeKeys select the keys copied from this source, they support the same patterns as CopyResourceSpec.IncludeKeys
+	// +kubebuilder:validation:Optional
+	IncludeKeys []string `json:"includeKeys,omitempty"`
+
+	// The ExcludeKeys remove keys copied from this source, they support the same patterns as CopyResourceSpec.IncludeKeys
+	// +kubebuilder:validation:Optional
+	ExcludeKeys []string `json:"excludeKeys,omitempty"`
+}
+
+// KeyMapping maps a key of the source data to a key of the target data
+type KeyMapping struct {
+	// The From key of the source data
+	// +kubebuilder:validation:MinLength=1
+	From string `json:"from"`
+
+	// The To key of the target data
+	// +kubebuilder:validation:MinLength=1
+	To string `json:"to"`
 }
 
 // CopyResourceStatus defines the observed state of CopyResource
 type CopyResourceStatus struct {
+	// The ObservedGeneration is the generation of the CopyResource last reconciled
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The LastSyncTime is the last time a target Resource was created or updated
+	// +kubebuilder:validation:Optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// The Target references the target Resources, which are named alike in every target namespace
+	// +kubebuilder:validation:Optional
+	Target *TargetReference `json:"target,omitempty"`
+
+	// The Message describes the current state of the CopyResource in a human readable form
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// The Conditions describe the current state of the CopyResource
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// The ResourceVersion of the source Resource copied to all targets, the ResourceVersions of several sources are joined by commas
 	ResourceVersion string `json:"resourceVersion"`
+
+	// The Targets the Resource has been copied to, one entry per target namespace
+	// +kubebuilder:validation:Optional
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// The DriftCount counts how often a target Resource was modified outside of the operator and restored
+	// +kubebuilder:validation:Optional
+	DriftCount int64 `json:"driftCount,omitempty"`
+
+	// The LastDriftTime is the last time a modified target Resource was restored
+	// +kubebuilder:validation:Optional
+	LastDriftTime *metav1.Time `json:"lastDriftTime,omitempty"`
+
+	// The CopiedKeys of the source data, which are copied to the targets after applying IncludeKeys and ExcludeKeys
+	// +kubebuilder:validation:Optional
+	CopiedKeys []string `json:"copiedKeys,omitempty"`
+}
+
+// TargetReference references the target Resources of a CopyResource
+type TargetReference struct {
+	// The APIVersion of the target Resources
+	APIVersion string `json:"apiVersion"`
+
+	// The Kind of the target Resources
+	Kind string `json:"kind"`
+
+	// The Name of the target Resources
+	Name string `json:"name"`
+}
+
+// The ConditionTypes of a CopyResource
+const (
+	// ConditionReady is True if the source Resource is copied to all targets without conflicts
+	ConditionReady = "Ready"
+	// ConditionSourceFound is True if the source Resource exists
+	ConditionSourceFound = "SourceFound"
+	// ConditionTargetSynced is True if all target Resources are up to date
+	ConditionTargetSynced = "TargetSynced"
+	// ConditionConflict is True if a target Resource is claimed by someone else
+	ConditionConflict = "Conflict"
+	// ConditionKeysMapped is True if all sources are merged, all KeyMappings resolve to existing source keys
+	// and distinct target keys and all Transform templates are rendered
+	ConditionKeysMapped = "KeysMapped"
+	// ConditionPolicyDenied is True if a CopyPolicy forbids copying into any of the target namespaces
+	ConditionPolicyDenied = "PolicyDenied"
+	// ConditionSourceOptedIn is True if all source Resources allow copying into all target namespaces,
+	// it is only set if the operator requires the opt-in of source Resources
+	ConditionSourceOptedIn = "SourceOptedIn"
+)
+
+// Condition describes one aspect of the current state of a CopyResource, modelled after metav1.Condition
+type Condition struct {
+	// The Type of the condition, e.g. Ready
+	Type string `json:"type"`
+
+	// The Status of the condition, one of True, False, Unknown
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status metav1.ConditionStatus `json:"status"`
+
+	// The ObservedGeneration is the generation of the CopyResource the condition was set upon
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The LastTransitionTime is the last time the condition changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// The Reason is a CamelCase identifier of the cause of the last transition
+	Reason string `json:"reason"`
+
+	// The Message describes the last transition in a human readable form
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// TargetStatus defines the observed state of a single target Resource
+type TargetStatus struct {
+	// The Namespace of the target Resource
+	Namespace string `json:"namespace"`
+
+	// The Name of the target Resource
+	Name string `json:"name"`
+
+	// The ResourceVersion of the source Resource last copied to this target
+	// +kubebuilder:validation:Optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// The Fingerprint of the content last copied to this target
+	// +kubebuilder:validation:Optional
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Synced is true if the last copy to this target succeeded
+	Synced bool `json:"synced"`
+
+	// The Message describing why the last copy to this target failed
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.kind"
+// +kubebuilder:printcolumn:name="Source",type="string",JSONPath=".spec.metaName"
+// +kubebuilder:printcolumn:name="Target",type="string",JSONPath=".status.target.name"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // CopyResource is the Schema for the copyresources API
 type CopyResource struct {
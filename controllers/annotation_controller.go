@@ -0,0 +1,370 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// Secrets and ConfigMaps carrying one of the following annotations are copied without a CopyResource
+const (
+	// CopyToAnnotation holds the comma separated target namespaces of an annotated source Resource
+	CopyToAnnotation = "copier.baloise.ch/copy-to"
+	// CopyToSelectorAnnotation holds a label selector of the target namespaces of an annotated source Resource
+	CopyToSelectorAnnotation = "copier.baloise.ch/copy-to-selector"
+)
+
+// annotatedKinds are the kinds of source Resources which may be copied by annotation
+var annotatedKinds = map[string]runtime.Object{
+	"Secret":    &v1.Secret{},
+	"ConfigMap": &v1.ConfigMap{},
+}
+
+// AnnotationReconciler copies annotated Secrets and ConfigMaps to their target namespaces.
+// Every annotated source Resource is translated into a CopyResource in memory, which is synced by the
+// copy pipeline of the CopyResourceReconciler. Its targets are deleted once the annotations are removed.
+type AnnotationReconciler struct {
+	client.Client
+	Log logr.Logger
+	// Handlers implement the copy semantics per kind, defaults to NewResourceHandlerRegistry()
+	Handlers *ResourceHandlerRegistry
+	// Recorder records Events on the annotated source Resources, defaults to the managers EventRecorder
+	Recorder record.EventRecorder
+	// APIReader is passed on to the copy pipeline, defaults to the managers APIReader
+	APIReader client.Reader
+
+	mutex sync.Mutex
+	// copies holds the in memory CopyResources of all annotated source Resources by their source index value,
+	// they keep the status between reconciles and route the events of targets and namespaces
+	copies map[string]*resourcebaloisechv1alpha1.CopyResource
+}
+
+// reconcileKind returns the reconcile function for annotated source Resources of kind
+func (r *AnnotationReconciler) reconcileKind(kind string) reconcile.Func {
+	return func(req reconcile.Request) (reconcile.Result, error) {
+		log := r.Log.WithValues(kind, req.NamespacedName)
+		key := sourceIndexValue(kind, req.Namespace, req.Name)
+		gvk := schema.GroupVersionKind{Version: "v1", Kind: kind}
+
+		// Use an unstructured type to share the copy pipeline, this also avoids the cache reader
+		sourceResource := &unstructured.Unstructured{}
+		sourceResource.SetGroupVersionKind(gvk)
+		err := r.Get(context.TODO(), req.NamespacedName, sourceResource)
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to get source resource.")
+			return reconcile.Result{}, err
+		}
+		if errors.IsNotFound(err) || !isAnnotatedSource(sourceResource) || !sourceResource.GetDeletionTimestamp().IsZero() {
+			return reconcile.Result{}, r.release(key, gvk, req.NamespacedName, log)
+		}
+
+		copyResource, err := newAnnotationCopyResource(sourceResource)
+		if err != nil {
+			log.Info("Invalid copy annotations.", "reason", err.Error())
+			r.Recorder.Eventf(sourceResource, v1.EventTypeWarning, EventReasonInvalidAnnotation, "Invalid copy annotations: %s", err.Error())
+			return reconcile.Result{}, nil
+		}
+		if previous := r.getCopy(key); previous != nil {
+			copyResource.Status = previous.Status
+		}
+
+		status := copyResource.Status.DeepCopy()
+		result, err := r.newCopier(sourceResource).syncTargets(copyResource, status, log)
+		updateReadyCondition(status)
+		ready := findCondition(status.Conditions, resourcebaloisechv1alpha1.ConditionReady)
+		if ready.Status != metav1.ConditionTrue {
+			log.Info("Annotated source resource not copied to all targets.", "reason", status.Message)
+			// There is no status to look at, so the reason is recorded once per change as Event on the source
+			if status.Message != copyResource.Status.Message {
+				r.Recorder.Eventf(sourceResource, v1.EventTypeWarning, ready.Reason, "%s", status.Message)
+			}
+		}
+		copyResource.Status = *status
+		r.setCopy(key, copyResource)
+		return result, requeueError(err)
+	}
+}
+
+// newCopier returns a CopyResourceReconciler running the copy pipeline on behalf of the annotated source Resource,
+// which receives all Events of the pipeline. Anyone who may edit a source Resource may annotate it and no admission
+// webhook checks the target namespaces, so only target namespaces explicitly allowed by a CopyPolicy are copied to.
+func (r *AnnotationReconciler) newCopier(sourceResource runtime.Object) *CopyResourceReconciler {
+	return &CopyResourceReconciler{
+		Client:           r.Client,
+		Log:              r.Log,
+		Handlers:         r.Handlers,
+		Recorder:         sourceEventRecorder{EventRecorder: r.Recorder, source: sourceResource},
+		APIReader:        r.APIReader,
+		annotationCopies: true,
+	}
+}
+
+// release deletes all targets of a source Resource which is not annotated anymore or was deleted.
+// The targets are looked up by their ownership, as the UID of a deleted source Resource may not be known anymore,
+// only targets of a CopyResource with the same namespace and name are left alone.
+func (r *AnnotationReconciler) release(key string, gvk schema.GroupVersionKind, owner types.NamespacedName, log logr.Logger) error {
+	targets, err := listOwnedTargets(r.Client, gvk, client.MatchingLabels{SourceNamespaceLabel: owner.Namespace})
+	if err != nil {
+		log.Error(err, "Failed to list target resources.")
+		return err
+	}
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{}
+	err = r.Get(context.TODO(), owner, copyResource)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get CopyResource.", "namespacedName", owner)
+		return err
+	}
+	for i := range targets {
+		target := &targets[i]
+		targetOwner, ok := getOwner(target)
+		if !ok || targetOwner != owner || (err == nil && target.GetLabels()[CopyResourceUIDLabel] == string(copyResource.UID)) {
+			continue
+		}
+		releaseErr := releaseTarget(r.Client, target, log)
+		if releaseErr != nil {
+			log.Error(releaseErr, "Failed to release target resource.", "name", target.GetName(), "namespace ", target.GetNamespace())
+			return releaseErr
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.copies, key)
+	return nil
+}
+
+func (r *AnnotationReconciler) getCopy(key string) *resourcebaloisechv1alpha1.CopyResource {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.copies[key]
+}
+
+func (r *AnnotationReconciler) setCopy(key string, copyResource *resourcebaloisechv1alpha1.CopyResource) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.copies[key] = copyResource
+}
+
+// removeSourceAnnotations removes the annotations which only apply to source Resources from the target Resource,
+// otherwise every target of an annotated source Resource would be copied again as a source of its own
+func removeSourceAnnotations(target metav1.Object) {
+	annotations := map[string]string{}
+	for key, value := range target.GetAnnotations() {
+		if key != CopyToAnnotation && key != CopyToSelectorAnnotation && key != allowedTargetsAnnotation {
+			annotations[key] = value
+		}
+	}
+	target.SetAnnotations(annotations)
+}
+
+// isAnnotatedSource returns true if the source Resource carries any of the copy annotations.
+// Target Resources are never copied again, even if they carry copy annotations of an older operator version.
+func isAnnotatedSource(object metav1.Object) bool {
+	if _, isTarget := object.GetLabels()[CopyResourceUIDLabel]; isTarget {
+		return false
+	}
+	_, hasCopyTo := object.GetAnnotations()[CopyToAnnotation]
+	_, hasCopyToSelector := object.GetAnnotations()[CopyToSelectorAnnotation]
+	return hasCopyTo || hasCopyToSelector
+}
+
+// newAnnotationCopyResource translates the copy annotations of the source Resource into a CopyResource.
+// The CopyResource takes over the namespace, name and UID of the source Resource, which identify the targets.
+func newAnnotationCopyResource(sourceResource *unstructured.Unstructured) (*resourcebaloisechv1alpha1.CopyResource, error) {
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         sourceResource.GetNamespace(),
+			Name:              sourceResource.GetName(),
+			UID:               sourceResource.GetUID(),
+			CreationTimestamp: sourceResource.GetCreationTimestamp(),
+		},
+		Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+			APIVersion:     sourceResource.GetAPIVersion(),
+			Kind:           sourceResource.GetKind(),
+			MetaName:       sourceResource.GetName(),
+			TargetName:     sourceResource.GetName(),
+			DeletionPolicy: resourcebaloisechv1alpha1.DeletionPolicyDelete,
+			ConflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyFail,
+		},
+	}
+	for _, namespace := range strings.Split(sourceResource.GetAnnotations()[CopyToAnnotation], ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			copyResource.Spec.TargetNamespaces = append(copyResource.Spec.TargetNamespaces, namespace)
+		}
+	}
+	if value, ok := sourceResource.GetAnnotations()[CopyToSelectorAnnotation]; ok {
+		selector, err := metav1.ParseToLabelSelector(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", CopyToSelectorAnnotation, err)
+		}
+		copyResource.Spec.TargetNamespaceSelector = selector
+	}
+	return copyResource, nil
+}
+
+// sourceEventRecorder records the Events of the in memory CopyResources on their annotated source Resource
+type sourceEventRecorder struct {
+	record.EventRecorder
+	source runtime.Object
+}
+
+func (s sourceEventRecorder) redirect(object runtime.Object) runtime.Object {
+	if _, ok := object.(*resourcebaloisechv1alpha1.CopyResource); ok {
+		return s.source
+	}
+	return object
+}
+
+func (s sourceEventRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	s.EventRecorder.Event(s.redirect(object), eventType, reason, message)
+}
+
+func (s sourceEventRecorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	s.EventRecorder.Eventf(s.redirect(object), eventType, reason, messageFmt, args...)
+}
+
+func (s sourceEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	s.EventRecorder.AnnotatedEventf(s.redirect(object), annotations, eventType, reason, messageFmt, args...)
+}
+
+func (r *AnnotationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Handlers == nil {
+		r.Handlers = NewResourceHandlerRegistry()
+	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("os3-copier")
+	}
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+	r.copies = map[string]*resourcebaloisechv1alpha1.CopyResource{}
+
+	// Only annotated source Resources and those which just lost their annotations are reconciled
+	annotated := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isAnnotatedSource(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isAnnotatedSource(e.MetaOld) || isAnnotatedSource(e.MetaNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isAnnotatedSource(e.Meta)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return isAnnotatedSource(e.Meta)
+		},
+	}
+	for kind, object := range annotatedKinds {
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named(strings.ToLower(kind)+"-annotations").
+			For(object, builder.WithPredicates(annotated)).
+			Watches(&source.Kind{Type: object}, &handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.mapTargetToSource(kind)),
+			}).
+			Watches(&source.Kind{Type: &v1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.mapNamespaceToSources(kind)),
+			}).
+			Watches(&source.Kind{Type: &resourcebaloisechv1alpha1.CopyPolicy{}}, &handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.mapCopyPolicyToSources(kind)),
+			}).
+			Complete(r.reconcileKind(kind))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapTargetToSource returns a mapper enqueuing the annotated source Resource of kind owning the changed target Resource
+func (r *AnnotationReconciler) mapTargetToSource(kind string) func(handler.MapObject) []reconcile.Request {
+	return func(target handler.MapObject) []reconcile.Request {
+		owner, ok := getOwner(target.Meta)
+		if !ok || r.getCopy(sourceIndexValue(kind, owner.Namespace, owner.Name)) == nil {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: owner}}
+	}
+}
+
+// mapNamespaceToSources returns a mapper enqueuing all annotated source Resources of kind
+// whose target namespace selector matches the changed namespace
+func (r *AnnotationReconciler) mapNamespaceToSources(kind string) func(handler.MapObject) []reconcile.Request {
+	return func(namespace handler.MapObject) []reconcile.Request {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		var requests []reconcile.Request
+		for _, copyResource := range r.copies {
+			if copyResource.Spec.Kind != kind || copyResource.Spec.TargetNamespaceSelector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(copyResource.Spec.TargetNamespaceSelector)
+			if err != nil || !selector.Matches(labels.Set(namespace.Meta.GetLabels())) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: copyResource.Namespace,
+				Name:      copyResource.Name,
+			}})
+		}
+		return requests
+	}
+}
+
+// mapCopyPolicyToSources returns a mapper enqueuing all annotated source Resources of kind,
+// as any of them may be affected by the changed CopyPolicy
+func (r *AnnotationReconciler) mapCopyPolicyToSources(kind string) func(handler.MapObject) []reconcile.Request {
+	return func(copyPolicy handler.MapObject) []reconcile.Request {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		var requests []reconcile.Request
+		for _, copyResource := range r.copies {
+			if copyResource.Spec.Kind == kind {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: copyResource.Namespace,
+					Name:      copyResource.Name,
+				}})
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,162 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// conflictError reports a target Resource which may not be written by the CopyResource
+type conflictError struct {
+	error
+}
+
+func isConflict(err error) bool {
+	_, ok := err.(conflictError)
+	return ok
+}
+
+// checkConflict returns a conflictError if the ConflictPolicy of the CopyResource forbids to write the existing target Resource.
+// Targets written by competitors, which lost the claim on the target to the CopyResource, are always taken over.
+func checkConflict(existingTarget metav1.Object, copyResource *resourcebaloisechv1alpha1.CopyResource, competitors []resourcebaloisechv1alpha1.CopyResource) error {
+	if isManagedBy(existingTarget, copyResource) {
+		return nil
+	}
+	for i := range competitors {
+		if isManagedBy(existingTarget, &competitors[i]) {
+			return nil
+		}
+	}
+
+	owner := "not managed by any CopyResource"
+	if isManaged(existingTarget) {
+		owner = "managed by CopyResource " + existingTarget.GetAnnotations()[CopyResourceAnnotation]
+	}
+
+	switch getConflictPolicy(copyResource) {
+	case resourcebaloisechv1alpha1.ConflictPolicyOverwrite:
+		return nil
+	case resourcebaloisechv1alpha1.ConflictPolicyAdopt:
+		if !isManaged(existingTarget) {
+			return nil
+		}
+	}
+	return conflictError{fmt.Errorf("target %s/%s already exists and is %s", existingTarget.GetNamespace(), existingTarget.GetName(), owner)}
+}
+
+func getConflictPolicy(copyResource *resourcebaloisechv1alpha1.CopyResource) resourcebaloisechv1alpha1.ConflictPolicy {
+	if copyResource.Spec.ConflictPolicy == "" {
+		return resourcebaloisechv1alpha1.ConflictPolicyFail
+	}
+	return copyResource.Spec.ConflictPolicy
+}
+
+// targetIndexKey is the field index of CopyResources by their resolved target Resources
+const targetIndexKey = ".status.targets"
+
+func targetIndexValue(groupKind schema.GroupKind, namespace string, name string) string {
+	return groupKind.String() + "/" + namespace + "/" + name
+}
+
+// targetIndexValues returns the index values of all target Resources resolved by the last reconcile of the CopyResource
+func targetIndexValues(copyResource *resourcebaloisechv1alpha1.CopyResource) []string {
+	if copyResource.Status.Target == nil {
+		return nil
+	}
+	groupVersion, err := schema.ParseGroupVersion(copyResource.Status.Target.APIVersion)
+	if err != nil {
+		return nil
+	}
+	groupKind := groupVersion.WithKind(copyResource.Status.Target.Kind).GroupKind()
+	var values []string
+	for _, target := range copyResource.Status.Targets {
+		values = append(values, targetIndexValue(groupKind, target.Namespace, target.Name))
+	}
+	return values
+}
+
+// findCompetitors returns all other CopyResources which claim the same target Resource and
+// the oldest of all claims, which wins the target. The winner is nil if the CopyResource itself is the oldest.
+func (r *CopyResourceReconciler) findCompetitors(copyResource *resourcebaloisechv1alpha1.CopyResource, groupKind schema.GroupKind, namespace string, name string) (winner *resourcebaloisechv1alpha1.CopyResource, competitors []resourcebaloisechv1alpha1.CopyResource, err error) {
+	copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+	err = r.List(context.TODO(), copyResources, client.MatchingFields{targetIndexKey: targetIndexValue(groupKind, namespace, name)})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldest := copyResource
+	for i := range copyResources.Items {
+		competitor := &copyResources.Items[i]
+		if competitor.UID == copyResource.UID || !competitor.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		competitors = append(competitors, *competitor)
+		if isOlder(competitor, oldest) {
+			oldest = competitor
+		}
+	}
+	if oldest == copyResource {
+		return nil, competitors, nil
+	}
+	return oldest, competitors, nil
+}
+
+// isOlder orders CopyResources by creation, CopyResources created in the same second are ordered by namespace and name
+func isOlder(a *resourcebaloisechv1alpha1.CopyResource, b *resourcebaloisechv1alpha1.CopyResource) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+}
+
+// mapCopyResourceToCompetitors enqueues all other CopyResources claiming a target Resource of the changed CopyResource,
+// so they can take over when the CopyResource is deleted or stops claiming the target
+func (r *CopyResourceReconciler) mapCopyResourceToCompetitors(object handler.MapObject) []reconcile.Request {
+	copyResource, ok := object.Object.(*resourcebaloisechv1alpha1.CopyResource)
+	if !ok {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, value := range targetIndexValues(copyResource) {
+		copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+		err := r.List(context.TODO(), copyResources, client.MatchingFields{targetIndexKey: value})
+		if err != nil {
+			r.Log.Error(err, "Failed to list CopyResources.", "target", value)
+			continue
+		}
+		for _, competitor := range copyResources.Items {
+			if competitor.UID != copyResource.UID {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: competitor.Namespace,
+					Name:      competitor.Name,
+				}})
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,368 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+var secretTarget = schema.GroupKind{Kind: "Secret"}
+
+// indexedClient filters CopyResources by the target index, which the fake client ignores
+type indexedClient struct {
+	client.Client
+}
+
+func (c *indexedClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	err := c.Client.List(ctx, list, opts...)
+	if err != nil {
+		return err
+	}
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	copyResources, ok := list.(*resourcebaloisechv1alpha1.CopyResourceList)
+	if !ok || listOptions.FieldSelector == nil {
+		return nil
+	}
+	value, found := listOptions.FieldSelector.RequiresExactMatch(targetIndexKey)
+	if !found {
+		return nil
+	}
+	var items []resourcebaloisechv1alpha1.CopyResource
+	for _, copyResource := range copyResources.Items {
+		if containsString(targetIndexValues(&copyResource), value) {
+			items = append(items, copyResource)
+		}
+	}
+	copyResources.Items = items
+	return nil
+}
+
+// claim records the target namespace in the status of the CopyResource, as a reconcile would
+func claim(copyResource *resourcebaloisechv1alpha1.CopyResource, targetNamespace string) *resourcebaloisechv1alpha1.CopyResource {
+	copyResource.Status.Target = &resourcebaloisechv1alpha1.TargetReference{APIVersion: "v1", Kind: "Secret"}
+	copyResource.Status.Targets = append(copyResource.Status.Targets, resourcebaloisechv1alpha1.TargetStatus{
+		Namespace: targetNamespace,
+		Name:      getTargetName(copyResource),
+	})
+	return copyResource
+}
+
+func TestIsOlder(t *testing.T) {
+	tests := []struct {
+		name string
+		a    *resourcebaloisechv1alpha1.CopyResource
+		b    *resourcebaloisechv1alpha1.CopyResource
+		want bool
+	}{
+		{
+			name: "created before",
+			a:    newTestCopyResource("team-b", "registry", 0, ""),
+			b:    newTestCopyResource("team-a", "registry", 1, ""),
+			want: true,
+		},
+		{
+			name: "created after",
+			a:    newTestCopyResource("team-a", "registry", 1, ""),
+			b:    newTestCopyResource("team-b", "registry", 0, ""),
+		},
+		{
+			name: "same creation orders by namespace",
+			a:    newTestCopyResource("team-a", "registry", 0, ""),
+			b:    newTestCopyResource("team-b", "a", 0, ""),
+			want: true,
+		},
+		{
+			name: "same creation orders by name",
+			a:    newTestCopyResource("team-a", "a", 0, ""),
+			b:    newTestCopyResource("team-a", "b", 0, ""),
+			want: true,
+		},
+		{
+			name: "same creation and later name",
+			a:    newTestCopyResource("team-a", "b", 0, ""),
+			b:    newTestCopyResource("team-a", "a", 0, ""),
+		},
+		{
+			name: "not older than itself",
+			a:    newTestCopyResource("team-a", "a", 0, ""),
+			b:    newTestCopyResource("team-a", "a", 0, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOlder(tt.a, tt.b); got != tt.want {
+				t.Errorf("isOlder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConflict(t *testing.T) {
+	copyResource := newTestCopyResource("team", "registry", 0, "")
+	competitor := newTestCopyResource("other", "registry", 1, "")
+	stranger := newTestCopyResource("stranger", "registry", 2, "")
+	recreated := copyResource.DeepCopy()
+	recreated.UID = "previous"
+
+	tests := []struct {
+		name           string
+		target         *v1.Secret
+		conflictPolicy resourcebaloisechv1alpha1.ConflictPolicy
+		wantErr        string
+	}{
+		{
+			name:   "own target",
+			target: newTestTarget(copyResource, nil),
+		},
+		{
+			name:   "target of a previous CopyResource of the same name",
+			target: newTestTarget(recreated, nil),
+		},
+		{
+			name:   "target of a competitor",
+			target: newTestTarget(competitor, nil),
+		},
+		{
+			name:    "unmanaged target fails",
+			target:  newTestTarget(nil, nil),
+			wantErr: "target target/registry already exists and is not managed by any CopyResource",
+		},
+		{
+			name:           "unmanaged target is adopted",
+			target:         newTestTarget(nil, nil),
+			conflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyAdopt,
+		},
+		{
+			name:           "unmanaged target is overwritten",
+			target:         newTestTarget(nil, nil),
+			conflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyOverwrite,
+		},
+		{
+			name:    "target of another CopyResource fails",
+			target:  newTestTarget(stranger, nil),
+			wantErr: "target target/registry already exists and is managed by CopyResource stranger/registry",
+		},
+		{
+			name:           "target of another CopyResource is not adopted",
+			target:         newTestTarget(stranger, nil),
+			conflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyAdopt,
+			wantErr:        "target target/registry already exists and is managed by CopyResource stranger/registry",
+		},
+		{
+			name:           "target of another CopyResource is overwritten",
+			target:         newTestTarget(stranger, nil),
+			conflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyOverwrite,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copyResource := copyResource.DeepCopy()
+			copyResource.Spec.ConflictPolicy = tt.conflictPolicy
+			err := checkConflict(tt.target, copyResource, []resourcebaloisechv1alpha1.CopyResource{*competitor})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkConflict() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkConflict() error = %v, want %q", err, tt.wantErr)
+			}
+			if !isConflict(err) {
+				t.Errorf("checkConflict() error %v is no conflict", err)
+			}
+		})
+	}
+}
+
+func TestFindCompetitors(t *testing.T) {
+	oldest := claim(newTestCopyResource("team-a", "registry", 0, ""), "target")
+	sameSecond := claim(newTestCopyResource("team-b", "registry", 0, ""), "target")
+	newer := claim(newTestCopyResource("team-c", "registry", 1, ""), "target")
+	unclaimed := newTestCopyResource("team-d", "registry", 2, "")
+	otherTarget := claim(newTestCopyResource("team-e", "registry", 0, ""), "other")
+	deleted := claim(newTestCopyResource("team-0", "registry", -1, ""), "target")
+	deletedAt := metav1.NewTime(testCreationTime)
+	deleted.DeletionTimestamp = &deletedAt
+
+	tests := []struct {
+		name            string
+		copyResource    *resourcebaloisechv1alpha1.CopyResource
+		objects         []runtime.Object
+		wantWinner      string
+		wantCompetitors []string
+	}{
+		{
+			name:         "no competitors",
+			copyResource: newer,
+			objects:      []runtime.Object{newer, unclaimed, otherTarget},
+		},
+		{
+			name:            "oldest wins",
+			copyResource:    newer,
+			objects:         []runtime.Object{oldest, newer, sameSecond},
+			wantWinner:      "team-a/registry",
+			wantCompetitors: []string{"team-a/registry", "team-b/registry"},
+		},
+		{
+			name:            "oldest is no winner itself",
+			copyResource:    oldest,
+			objects:         []runtime.Object{oldest, newer, sameSecond},
+			wantCompetitors: []string{"team-b/registry", "team-c/registry"},
+		},
+		{
+			name:            "same creation is won by namespace and name",
+			copyResource:    sameSecond,
+			objects:         []runtime.Object{oldest, sameSecond},
+			wantWinner:      "team-a/registry",
+			wantCompetitors: []string{"team-a/registry"},
+		},
+		{
+			name:            "newer CopyResource without claim loses",
+			copyResource:    unclaimed,
+			objects:         []runtime.Object{newer, unclaimed},
+			wantWinner:      "team-c/registry",
+			wantCompetitors: []string{"team-c/registry"},
+		},
+		{
+			name:            "CopyResources being deleted don't compete",
+			copyResource:    oldest,
+			objects:         []runtime.Object{deleted, oldest, newer},
+			wantCompetitors: []string{"team-c/registry"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReconciler(tt.objects...)
+			winner, competitors, err := r.findCompetitors(tt.copyResource, secretTarget, "target", "registry")
+			if err != nil {
+				t.Fatalf("findCompetitors() error = %v", err)
+			}
+			gotWinner := ""
+			if winner != nil {
+				gotWinner = winner.Namespace + "/" + winner.Name
+			}
+			var gotCompetitors []string
+			for _, competitor := range competitors {
+				gotCompetitors = append(gotCompetitors, competitor.Namespace+"/"+competitor.Name)
+			}
+			sort.Strings(gotCompetitors)
+			if gotWinner != tt.wantWinner {
+				t.Errorf("findCompetitors() winner = %q, want %q", gotWinner, tt.wantWinner)
+			}
+			if !reflect.DeepEqual(gotCompetitors, tt.wantCompetitors) {
+				t.Errorf("findCompetitors() competitors = %v, want %v", gotCompetitors, tt.wantCompetitors)
+			}
+		})
+	}
+}
+
+func TestCompetingCopyResources(t *testing.T) {
+	older := claim(newTestCopyResource("team-a", "registry", 0, ""), "target")
+	newer := claim(newTestCopyResource("team-b", "registry", 1, ""), "target")
+	// The newer CopyResource wrote the target before the older one claimed it
+	r := newTestReconciler(older, newer, newTestTarget(newer, map[string][]byte{"token": []byte("newer")}))
+	recorder := r.Recorder.(*record.FakeRecorder)
+
+	copyTo := func(copyResource *resourcebaloisechv1alpha1.CopyResource, token string) (bool, error) {
+		source, preparedTarget := prepareTestTarget(t, r, "1", map[string]interface{}{"token": encode(token)})
+		_, written, _, err := r.copyToTarget(copyResource, r.getResourceHandler(source.GroupVersionKind()), source, preparedTarget, "target", r.Log)
+		return written, err
+	}
+	getTarget := func() *v1.Secret {
+		target := &v1.Secret{}
+		err := r.Get(context.TODO(), types.NamespacedName{Namespace: "target", Name: "registry"}, target)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		return target
+	}
+
+	written, err := copyTo(newer, "newer")
+	if !isConflict(err) || written {
+		t.Fatalf("newer copyToTarget() written = %v, error = %v, want conflict", written, err)
+	}
+	if want := "target target/registry is claimed by the older CopyResource team-a/registry"; err.Error() != want {
+		t.Errorf("newer copyToTarget() error = %v, want %q", err, want)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, EventReasonTargetConflict) {
+			t.Errorf("event = %q, want %s", event, EventReasonTargetConflict)
+		}
+	default:
+		t.Errorf("no %s event recorded", EventReasonTargetConflict)
+	}
+
+	written, err = copyTo(older, "older")
+	if err != nil || !written {
+		t.Fatalf("older copyToTarget() written = %v, error = %v, want written", written, err)
+	}
+	target := getTarget()
+	if !isOwnedBy(target, older) || string(target.Data["token"]) != "older" {
+		t.Fatalf("target was not taken over by the older CopyResource: %+v", target)
+	}
+
+	// The loser stops writing the target, so the CopyResources don't overwrite each other
+	written, err = copyTo(newer, "newer")
+	if !isConflict(err) || written {
+		t.Fatalf("newer copyToTarget() written = %v, error = %v, want conflict", written, err)
+	}
+	if current := getTarget(); current.ResourceVersion != target.ResourceVersion || !isOwnedBy(current, older) {
+		t.Errorf("target was written by the newer CopyResource: %+v", current)
+	}
+}
+
+func TestMapCopyResourceToCompetitors(t *testing.T) {
+	changed := claim(newTestCopyResource("team-a", "registry", 0, ""), "target")
+	claim(changed, "other")
+	competitor := claim(newTestCopyResource("team-b", "registry", 1, ""), "target")
+	otherCompetitor := claim(newTestCopyResource("team-c", "registry", 1, ""), "other")
+	unrelated := claim(newTestCopyResource("team-d", "registry", 1, ""), "unrelated")
+	r := newTestReconciler(changed, competitor, otherCompetitor, unrelated)
+
+	requests := r.mapCopyResourceToCompetitors(handler.MapObject{Meta: changed, Object: changed})
+	var got []string
+	for _, request := range requests {
+		got = append(got, request.String())
+	}
+	sort.Strings(got)
+	want := []string{"team-b/registry", "team-c/registry"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mapCopyResourceToCompetitors() = %v, want %v", got, want)
+	}
+
+	if requests := r.mapCopyResourceToCompetitors(handler.MapObject{Meta: unrelated, Object: unrelated}); len(requests) != 0 {
+		t.Errorf("mapCopyResourceToCompetitors() = %v, want no requests", requests)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+var (
+	secretGroupKind    = schema.GroupKind{Kind: "Secret"}
+	configMapGroupKind = schema.GroupKind{Kind: "ConfigMap"}
+)
+
+// GetTargetGroupVersionKind returns the GroupVersionKind of the target Resources, which defaults to the kind of the source.
+// Only conversions between Secrets and ConfigMaps are supported.
+func GetTargetGroupVersionKind(copyResource *resourcebaloisechv1alpha1.CopyResource) (schema.GroupVersionKind, error) {
+	gvk, err := getGroupVersionKind(copyResource)
+	if err != nil {
+		return gvk, err
+	}
+	if copyResource.Spec.TargetKind == "" || copyResource.Spec.TargetKind == gvk.Kind {
+		return gvk, nil
+	}
+	if !isConvertible(gvk.GroupKind()) || !isConvertible(schema.GroupKind{Kind: copyResource.Spec.TargetKind}) {
+		return gvk, fmt.Errorf("conversion of %s to %s is not supported", gvk.Kind, copyResource.Spec.TargetKind)
+	}
+	return gvk.GroupVersion().WithKind(copyResource.Spec.TargetKind), nil
+}
+
+func isConvertible(groupKind schema.GroupKind) bool {
+	return groupKind == secretGroupKind || groupKind == configMapGroupKind
+}
+
+// convert turns a Secret into a ConfigMap or a ConfigMap into a Secret, objects of the target kind are not changed.
+// Decoded Secret values which are no valid UTF-8 fail the conversion to a ConfigMap, unless binaryKeys routes them to binaryData.
+func convert(object *unstructured.Unstructured, gvk schema.GroupVersionKind, binaryKeys keyMatchers) error {
+	groupKind := object.GroupVersionKind().GroupKind()
+	if groupKind == gvk.GroupKind() {
+		return nil
+	}
+
+	switch {
+	case groupKind == secretGroupKind && gvk.GroupKind() == configMapGroupKind:
+		data := map[string]interface{}{}
+		binaryData := map[string]interface{}{}
+		encoded, _ := object.Object["data"].(map[string]interface{})
+		for key, value := range encoded {
+			text, _ := value.(string)
+			if binaryKeys.matches(key) {
+				binaryData[key] = text
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return fmt.Errorf("failed to decode key %s: %v", key, err)
+			}
+			if !utf8.Valid(decoded) {
+				return fmt.Errorf("key %s is no valid UTF-8, add it to binaryKeys to copy it to binaryData", key)
+			}
+			data[key] = string(decoded)
+		}
+		plain, _ := object.Object["stringData"].(map[string]interface{})
+		for key, value := range plain {
+			data[key] = value
+		}
+		delete(object.Object, "stringData")
+		delete(object.Object, "type")
+		setDataField(object, "data", data)
+		setDataField(object, "binaryData", binaryData)
+
+	case groupKind == configMapGroupKind && gvk.GroupKind() == secretGroupKind:
+		data := map[string]interface{}{}
+		plain, _ := object.Object["data"].(map[string]interface{})
+		for key, value := range plain {
+			text, _ := value.(string)
+			data[key] = base64.StdEncoding.EncodeToString([]byte(text))
+		}
+		// binaryData is base64 encoded like the data of a Secret
+		binaryData, _ := object.Object["binaryData"].(map[string]interface{})
+		for key, value := range binaryData {
+			data[key] = value
+		}
+		delete(object.Object, "binaryData")
+		delete(object.Object, "immutable")
+		setDataField(object, "data", data)
+		object.Object["type"] = "Opaque"
+
+	default:
+		return fmt.Errorf("conversion of %s to %s is not supported", groupKind.Kind, gvk.Kind)
+	}
+	object.SetGroupVersionKind(gvk)
+	return nil
+}
+
+// setDataField sets a data field of the object or removes it if data is empty
+func setDataField(object *unstructured.Unstructured, field string, data map[string]interface{}) {
+	if len(data) == 0 {
+		delete(object.Object, field)
+		return
+	}
+	object.Object[field] = data
+}
@@ -0,0 +1,175 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+func TestConvert(t *testing.T) {
+	secretGVK := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	configMapGVK := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	binary := string([]byte{0xff, 0xfe, 0x00})
+
+	tests := []struct {
+		name        string
+		kind        string
+		fields      map[string]interface{}
+		target      schema.GroupVersionKind
+		binaryKeys  []string
+		excludeKeys []string
+		want        map[string]interface{}
+		wantErr     string
+	}{
+		{
+			name:   "Secret to ConfigMap decodes data and keeps stringData",
+			kind:   "Secret",
+			fields: map[string]interface{}{"type": "Opaque", "data": map[string]interface{}{"a": encode("x")}, "stringData": map[string]interface{}{"b": "y"}},
+			target: configMapGVK,
+			want:   map[string]interface{}{"data": map[string]interface{}{"a": "x", "b": "y"}},
+		},
+		{
+			name:    "Secret to ConfigMap fails for values which are no valid UTF-8",
+			kind:    "Secret",
+			fields:  map[string]interface{}{"data": map[string]interface{}{"key.p12": encode(binary)}},
+			target:  configMapGVK,
+			wantErr: "key key.p12 is no valid UTF-8",
+		},
+		{
+			name:       "Secret to ConfigMap routes binaryKeys to binaryData",
+			kind:       "Secret",
+			fields:     map[string]interface{}{"data": map[string]interface{}{"key.p12": encode(binary), "a": encode("x")}},
+			target:     configMapGVK,
+			binaryKeys: []string{"*.p12"},
+			want:       map[string]interface{}{"data": map[string]interface{}{"a": "x"}, "binaryData": map[string]interface{}{"key.p12": encode(binary)}},
+		},
+		{
+			name:        "Secret to ConfigMap ignores excluded keys which are no valid UTF-8",
+			kind:        "Secret",
+			fields:      map[string]interface{}{"data": map[string]interface{}{"key.p12": encode(binary), "a": encode("x")}},
+			target:      configMapGVK,
+			excludeKeys: []string{"*.p12"},
+			want:        map[string]interface{}{"data": map[string]interface{}{"a": "x"}},
+		},
+		{
+			name:    "Secret to ConfigMap fails for invalid base64",
+			kind:    "Secret",
+			fields:  map[string]interface{}{"data": map[string]interface{}{"a": "!"}},
+			target:  configMapGVK,
+			wantErr: "failed to decode key a",
+		},
+		{
+			name:   "ConfigMap to Secret encodes data and moves binaryData",
+			kind:   "ConfigMap",
+			fields: map[string]interface{}{"data": map[string]interface{}{"a": "x"}, "binaryData": map[string]interface{}{"b": encode(binary)}, "immutable": true},
+			target: secretGVK,
+			want:   map[string]interface{}{"type": "Opaque", "data": map[string]interface{}{"a": encode("x"), "b": encode(binary)}},
+		},
+		{
+			name:   "same kind is not changed",
+			kind:   "Secret",
+			fields: map[string]interface{}{"type": "kubernetes.io/tls", "data": map[string]interface{}{"a": encode("x")}},
+			target: secretGVK,
+			want:   map[string]interface{}{"type": "kubernetes.io/tls", "data": map[string]interface{}{"a": encode("x")}},
+		},
+		{
+			name:    "other kinds are not supported",
+			kind:    "ConfigMap",
+			fields:  map[string]interface{}{},
+			target:  schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			wantErr: "conversion of ConfigMap to Deployment is not supported",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			copyResource := &resourcebaloisechv1alpha1.CopyResource{Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+				BinaryKeys:  test.binaryKeys,
+				ExcludeKeys: test.excludeKeys,
+			}}
+			processor, err := newDataProcessor(copyResource, test.target)
+			if err != nil {
+				t.Fatalf("invalid keys: %v", err)
+			}
+			object := newTestObject(test.kind, "a", "1", test.fields)
+			err = processor.process(object)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if object.GroupVersionKind() != test.target {
+				t.Errorf("expected kind %s, got %s", test.target, object.GroupVersionKind())
+			}
+			got := map[string]interface{}{}
+			for field, value := range object.Object {
+				if field != "apiVersion" && field != "kind" && field != "metadata" {
+					got[field] = value
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetTargetGroupVersionKind(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       string
+		targetKind string
+		want       string
+		wantErr    bool
+	}{
+		{name: "defaults to the kind", kind: "Secret", want: "Secret"},
+		{name: "Secret to ConfigMap", kind: "Secret", targetKind: "ConfigMap", want: "ConfigMap"},
+		{name: "ConfigMap to Secret", kind: "ConfigMap", targetKind: "Secret", want: "Secret"},
+		{name: "same kind of other kinds", kind: "Service", targetKind: "Service", want: "Service"},
+		{name: "other kinds are not convertible", kind: "Secret", targetKind: "Service", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			copyResource := &resourcebaloisechv1alpha1.CopyResource{Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+				Kind:       test.kind,
+				TargetKind: test.targetKind,
+			}}
+			gvk, err := GetTargetGroupVersionKind(copyResource)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", gvk)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gvk.Kind != test.want || gvk.Version != "v1" {
+				t.Errorf("expected v1 %s, got %s", test.want, gvk)
+			}
+		})
+	}
+}
@@ -23,39 +23,66 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
-	"github.com/jinzhu/copier"
 )
 
+// sourceNotFoundRequeueAfter is the delay to look for a missing source Resource again,
+// as sources of other kinds than Secret and ConfigMap are not watched
+const sourceNotFoundRequeueAfter = 1 * time.Minute
+
+// sourceIndexKey is the field index of CopyResources by the kind, namespace and name of their source Resources
+const sourceIndexKey = ".spec.source"
+
 // CopyResourceReconciler reconciles a CopyResource object
 type CopyResourceReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
-}
+	// Handlers implement the copy semantics per kind, defaults to NewResourceHandlerRegistry()
+	Handlers *ResourceHandlerRegistry
+	// Recorder records Events on CopyResources and target Resources, defaults to the managers EventRecorder
+	Recorder record.EventRecorder
+	// TargetEventsEnabled records Events on the target Resources in addition to the CopyResource
+	TargetEventsEnabled bool
+	// APIReader reads CopyGrants of source namespaces outside of the cached namespace, defaults to the managers APIReader
+	APIReader client.Reader
+	// SourceOptInRequired only copies source Resources to the target namespaces listed in their allowed-targets annotation
+	SourceOptInRequired bool
 
-type Object interface {
-	metav1.Object
-	runtime.Object
+	// annotationCopies marks the copies of annotated sources, which only copy to target namespaces
+	// explicitly permitted by an Allow rule of a CopyPolicy
+	annotationCopies bool
 }
 
 // +kubebuilder:rbac:groups=resource.baloise.ch,resources=copyresources,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=resource.baloise.ch,resources=copyresources/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=resource.baloise.ch,resources=copyresources/finalizers,verbs=update
+// +kubebuilder:rbac:groups=resource.baloise.ch,resources=copygrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=resource.baloise.ch,resources=copypolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=,resources=secrets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=,resources=secrets/finalizers,verbs=update
 // +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=,resources=configmaps/finalizers,verbs=update
 // +kubebuilder:rbac:groups=,resources=configmaps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=,resources=events,verbs=create;patch
 
 func (r *CopyResourceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("CopyResource", req.NamespacedName)
@@ -68,151 +95,607 @@ func (r *CopyResourceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "Failed to get CopyResource.", "namespacedName", req.NamespacedName)
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, err
 	}
 
-	namespacedName := types.NamespacedName{
-		Namespace: req.Namespace,
-		Name:      copyResource.Spec.MetaName,
+	if !copyResource.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalize(copyResource, log)
 	}
 
-	sourceResource, _ := StringToStruct(copyResource.Spec.Kind)
-	err = r.Client.Get(context.TODO(), namespacedName, sourceResource)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Source resource not found.", "namespacedName", namespacedName)
-		return ctrl.Result{}, nil
+	status := copyResource.Status.DeepCopy()
+	status.ObservedGeneration = copyResource.Generation
+	result, err := r.sync(copyResource, status, log)
+	if statusErr := r.updateStatus(copyResource, status, log); statusErr != nil {
+		return ctrl.Result{}, statusErr
 	}
+	return result, requeueError(err)
+}
+
+// sync copies the source Resource to all targets and records the outcome in status.
+// The returned error is only retried if it is transient.
+func (r *CopyResourceReconciler) sync(copyResource *resourcebaloisechv1alpha1.CopyResource, status *resourcebaloisechv1alpha1.CopyResourceStatus, log logr.Logger) (ctrl.Result, error) {
+	err := r.reconcileFinalizer(copyResource)
 	if err != nil {
-		log.Error(err, "Source resource error.", "namespacedName", namespacedName)
-		return ctrl.Result{}, nil
+		log.Error(err, "Failed to update CopyResource finalizers.")
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonFinalizerFailed,
+			"Failed to update finalizers: "+err.Error())
+		return ctrl.Result{}, err
 	}
+	return r.syncTargets(copyResource, status, log)
+}
 
-	targetResource, _ := StringToStruct(copyResource.Spec.Kind)
-	targetResource, _ = cloneResource(copyResource.Spec.Kind, sourceResource, targetResource)
-	targetResource.SetResourceVersion("")
-	targetResource.SetUID("")
-	targetResource.SetNamespace(copyResource.Spec.TargetNamespace)
-	if copyResource.Spec.TargetName != "" {
-		targetResource.SetName(copyResource.Spec.TargetName)
-	} else {
-		targetResource.SetName(copyResource.Namespace + "-" + copyResource.Name)
+// syncTargets copies the source Resources of the CopyResource to all targets and records the outcome in status.
+// It is shared with the AnnotationReconciler, so it must not modify the CopyResource itself.
+func (r *CopyResourceReconciler) syncTargets(copyResource *resourcebaloisechv1alpha1.CopyResource, status *resourcebaloisechv1alpha1.CopyResourceStatus, log logr.Logger) (ctrl.Result, error) {
+	var targetGVK schema.GroupVersionKind
+	gvk, err := getGroupVersionKind(copyResource)
+	if err == nil {
+		targetGVK, err = GetTargetGroupVersionKind(copyResource)
+	}
+	if err != nil {
+		log.Error(err, "Invalid kind.", "apiVersion", copyResource.Spec.APIVersion, "kind", copyResource.Spec.Kind, "targetKind", copyResource.Spec.TargetKind)
+		setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionFalse, ReasonInvalidKind,
+			"Invalid kind: "+err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
+	err = ValidateTargets(copyResource)
+	if err != nil {
+		log.Info("Invalid targets.", "reason", err.Error())
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonInvalidTargets, err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
+	status.Target = &resourcebaloisechv1alpha1.TargetReference{
+		APIVersion: targetGVK.GroupVersion().String(),
+		Kind:       targetGVK.Kind,
+		Name:       getTargetName(copyResource),
 	}
-	targetResource.SetOwnerReferences([]metav1.OwnerReference{buildOwnerReferenceToCopyResource(copyResource)})
 
-	exists := isObjectExists(r, targetResource, log)
+	resourceHandler := r.getResourceHandler(gvk)
+	targetHandler := r.getResourceHandler(targetGVK)
+
+	processor, err := newDataProcessor(copyResource, targetGVK)
+	if err != nil {
+		log.Error(err, "Invalid key filter or transform.")
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonInvalidKeys, err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
 
-	if copyResource.Status.ResourceVersion == "" ||
-		sourceResourceVersionHasChanged(copyResource.Spec.Kind, copyResource.Status.ResourceVersion, sourceResource) ||
-		!exists {
+	sources, err := getSources(copyResource)
+	if err != nil {
+		log.Error(err, "Invalid sources.")
+		setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionFalse, ReasonInvalidSources, err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
 
-		if !exists {
-			err = r.Client.Create(context.TODO(), targetResource)
-			if err != nil {
-				log.Error(err, "Failed to create resource.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
-				return ctrl.Result{}, nil
+	err = r.checkGrants(copyResource, gvk)
+	if err != nil && isTransient(err) {
+		log.Error(err, "Failed to list CopyGrants.", "namespace", getSourceNamespace(copyResource))
+		setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionFalse, ReasonSourceError,
+			"Failed to list CopyGrants: "+err.Error())
+		return ctrl.Result{}, err
+	}
+	if err != nil {
+		log.Info("Source not granted.", "reason", err.Error())
+		r.recordEvent(copyResource, v1.EventTypeWarning, EventReasonSourceNotGranted, "%s", err.Error())
+		setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionFalse, ReasonSourceNotGranted, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	var sourceResources []*unstructured.Unstructured
+	var sourceFilters []*keyFilter
+	for _, source := range sources {
+		namespacedName := types.NamespacedName{
+			Namespace: getSourceNamespace(copyResource),
+			Name:      source.name,
+		}
+		// Use an unstructured type to support any kind, this also avoids the cache reader
+		sourceResource := resourceHandler.NewObject(gvk)
+		err = r.Client.Get(context.TODO(), namespacedName, sourceResource)
+		if err != nil && errors.IsNotFound(err) {
+			log.Info("Source resource not found.", "namespacedName", namespacedName)
+			r.recordEvent(copyResource, v1.EventTypeWarning, EventReasonSourceNotFound, "Source %s %s not found", gvk.Kind, namespacedName)
+			setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionFalse, ReasonSourceNotFound,
+				fmt.Sprintf("Source %s %s not found", gvk.Kind, namespacedName))
+			return ctrl.Result{RequeueAfter: sourceNotFoundRequeueAfter}, nil
+		}
+		if err != nil {
+			log.Error(err, "Source resource error.", "namespacedName", namespacedName)
+			setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionFalse, ReasonSourceError,
+				fmt.Sprintf("Failed to get source %s %s: %s", gvk.Kind, namespacedName, err.Error()))
+			return ctrl.Result{}, err
+		}
+		sourceResources = append(sourceResources, sourceResource)
+		sourceFilters = append(sourceFilters, source.filter)
+	}
+	setCondition(status, resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionTrue, ReasonSourceFound,
+		fmt.Sprintf("Source %s %s found in %s", gvk.Kind, strings.Join(getSourceNames(copyResource), ", "), getSourceNamespace(copyResource)))
+
+	sourceResource, err := mergeSources(sourceResources, sourceFilters, getMergeStrategy(copyResource))
+	if err != nil {
+		log.Info("Failed to merge sources.", "reason", err.Error())
+		setCondition(status, resourcebaloisechv1alpha1.ConditionKeysMapped, metav1.ConditionFalse, ReasonMergeFailed, err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
+	status.CopiedKeys = processor.filter.keys(sourceResource)
+
+	// The target Resource is prepared once and only differs in namespace and name between the targets
+	preparedTarget, err := resourceHandler.Clone(sourceResource)
+	if err == nil {
+		err = resourceHandler.Sanitize(preparedTarget, copyResource.Spec.StripFields)
+	}
+	removeSourceAnnotations(preparedTarget)
+	if err != nil {
+		log.Error(err, "Failed to clone resource.")
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonSyncFailed,
+			"Failed to clone source: "+err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
+	err = processor.process(preparedTarget)
+	if err != nil {
+		log.Info("Failed to map keys.", "reason", err.Error())
+		setCondition(status, resourcebaloisechv1alpha1.ConditionKeysMapped, metav1.ConditionFalse, ReasonInvalidKeyMappings, err.Error())
+		return ctrl.Result{}, permanent(err)
+	}
+	setCondition(status, resourcebaloisechv1alpha1.ConditionKeysMapped, metav1.ConditionTrue, ReasonKeysMapped,
+		fmt.Sprintf("%d key mappings and %d templates applied", len(copyResource.Spec.KeyMappings), len(copyResource.Spec.Transform)))
+
+	targetNamespaces, err := r.getTargetNamespaces(copyResource)
+	if err != nil {
+		log.Error(err, "Failed to resolve target namespaces.")
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonInvalidTargets,
+			"Failed to resolve target namespaces: "+err.Error())
+		return ctrl.Result{}, err
+	}
+
+	copyPolicies, err := ListCopyPolicies(context.TODO(), r)
+	if err != nil {
+		log.Error(err, "Failed to list CopyPolicies.")
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonInvalidTargets,
+			"Failed to list CopyPolicies: "+err.Error())
+		return ctrl.Result{}, err
+	}
+	denials := evaluateCopyResource(copyPolicies, copyResource, targetNamespaces, r.annotationCopies)
+	if len(denials) > 0 {
+		var messages []string
+		for _, denial := range denials {
+			messages = append(messages, denial.String())
+			targetNamespaces = removeString(targetNamespaces, denial.Namespace)
+		}
+		log.Info("Target namespaces denied by CopyPolicies.", "denials", messages)
+		setCondition(status, resourcebaloisechv1alpha1.ConditionPolicyDenied, metav1.ConditionTrue, ReasonPolicyDenied,
+			fmt.Sprintf("Denied to copy to %d target namespaces: %s", len(denials), strings.Join(messages, "; ")))
+	} else {
+		setCondition(status, resourcebaloisechv1alpha1.ConditionPolicyDenied, metav1.ConditionFalse, ReasonPolicyAllowed, "All target namespaces are allowed")
+	}
+
+	if r.SourceOptInRequired {
+		deniedNamespaces, messages := checkSourceOptIn(sourceResources, targetNamespaces)
+		if len(messages) > 0 {
+			log.Info("Sources have not opted in to all target namespaces.", "namespaces", deniedNamespaces)
+			for _, deniedNamespace := range deniedNamespaces {
+				targetNamespaces = removeString(targetNamespaces, deniedNamespace)
 			}
-			log.Info("Successfully created.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
+			setCondition(status, resourcebaloisechv1alpha1.ConditionSourceOptedIn, metav1.ConditionFalse, ReasonSourceNotOptedIn,
+				"Source not opted in: "+strings.Join(messages, "; "))
 		} else {
+			setCondition(status, resourcebaloisechv1alpha1.ConditionSourceOptedIn, metav1.ConditionTrue, ReasonSourceOptedIn,
+				"Sources allow all target namespaces")
+		}
+	} else {
+		removeCondition(status, resourcebaloisechv1alpha1.ConditionSourceOptedIn)
+	}
+
+	status.Targets = nil
+	var failedNamespaces []string
+	var conflicts []string
+	var transientErrors []error
+	for _, targetNamespace := range targetNamespaces {
+		targetStatus, written, drifted, err := r.copyToTarget(copyResource, targetHandler, sourceResource, preparedTarget, targetNamespace, log)
+		if err != nil {
+			failedNamespaces = append(failedNamespaces, targetNamespace)
+			if isConflict(err) {
+				conflicts = append(conflicts, err.Error())
+			}
+			if isTransient(err) {
+				transientErrors = append(transientErrors, err)
+			}
+		}
+		if written {
+			now := metav1.Now()
+			status.LastSyncTime = &now
+		}
+		if drifted {
+			now := metav1.Now()
+			status.DriftCount++
+			status.LastDriftTime = &now
+		}
+		status.Targets = append(status.Targets, targetStatus)
+	}
+	if len(conflicts) > 0 {
+		setCondition(status, resourcebaloisechv1alpha1.ConditionConflict, metav1.ConditionTrue, ReasonTargetConflict,
+			fmt.Sprintf("Conflict policy %s prevents writing: %s", getConflictPolicy(copyResource), strings.Join(conflicts, "; ")))
+	} else {
+		setCondition(status, resourcebaloisechv1alpha1.ConditionConflict, metav1.ConditionFalse, ReasonNoConflict, "No conflicting target resources")
+	}
+
+	if len(failedNamespaces) > 0 {
+		setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionFalse, ReasonSyncFailed,
+			fmt.Sprintf("Failed to copy to %d of %d target namespaces: %s", len(failedNamespaces), len(targetNamespaces), strings.Join(failedNamespaces, ", ")))
+		return ctrl.Result{}, utilerrors.NewAggregate(transientErrors)
+	}
+
+	status.ResourceVersion = sourceResource.GetResourceVersion()
+	setCondition(status, resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionTrue, ReasonTargetsSynced,
+		fmt.Sprintf("Copied to %d target namespaces", len(targetNamespaces)))
+	err = r.releaseStaleTargets(copyResource, targetGVK, targetNamespaces, log)
+	if err == nil && copyResource.Status.Target != nil && copyResource.Status.Target.Kind != targetGVK.Kind {
+		// All targets of the previous kind are stale after the TargetKind changed
+		previousGVK := schema.FromAPIVersionAndKind(copyResource.Status.Target.APIVersion, copyResource.Status.Target.Kind)
+		err = r.releaseStaleTargets(copyResource, previousGVK, nil, log)
+	}
+	if err != nil {
+		log.Error(err, "Failed to release stale target resources.")
+	}
+	return ctrl.Result{}, err
+}
+
+// copyToTarget creates or updates the preparedTarget in targetNamespace and returns the resulting TargetStatus,
+// which holds the message of err if the copy failed.
+// written is true if the target Resource was created or updated, drifted is true if the target Resource
+// had been modified outside of the operator and was restored.
+func (r *CopyResourceReconciler) copyToTarget(copyResource *resourcebaloisechv1alpha1.CopyResource, resourceHandler ResourceHandler, sourceResource *unstructured.Unstructured, preparedTarget *unstructured.Unstructured, targetNamespace string, log logr.Logger) (targetStatus resourcebaloisechv1alpha1.TargetStatus, written bool, drifted bool, err error) {
+	targetStatus = resourcebaloisechv1alpha1.TargetStatus{
+		Namespace: targetNamespace,
+		Name:      getTargetName(copyResource),
+	}
+	previousStatus := findTargetStatus(copyResource.Status.Targets, targetNamespace)
+	if previousStatus != nil {
+		targetStatus.ResourceVersion = previousStatus.ResourceVersion
+		targetStatus.Fingerprint = previousStatus.Fingerprint
+	}
+
+	winner, competitors, err := r.findCompetitors(copyResource, preparedTarget.GroupVersionKind().GroupKind(), targetStatus.Namespace, targetStatus.Name)
+	if err != nil {
+		log.Error(err, "Failed to find competing CopyResources.", "name", targetStatus.Name, "namespace ", targetStatus.Namespace)
+		targetStatus.Message = err.Error()
+		return targetStatus, false, false, err
+	}
+	if winner != nil {
+		err = conflictError{fmt.Errorf("target %s/%s is claimed by the older CopyResource %s/%s", targetStatus.Namespace, targetStatus.Name, winner.Namespace, winner.Name)}
+		log.Info("Target resource conflict.", "name", targetStatus.Name, "namespace ", targetStatus.Namespace, "reason", err.Error())
+		r.recordEvent(copyResource, v1.EventTypeWarning, EventReasonTargetConflict, "Target %s/%s is claimed by the older CopyResource %s/%s",
+			targetStatus.Namespace, targetStatus.Name, winner.Namespace, winner.Name)
+		targetStatus.Message = err.Error()
+		return targetStatus, false, false, err
+	}
+
+	targetResource := preparedTarget.DeepCopy()
+	targetResource.SetNamespace(targetNamespace)
+	targetResource.SetName(targetStatus.Name)
+	setOwnership(targetResource, copyResource)
+
+	fingerprint, err := resourceHandler.Fingerprint(targetResource)
+	if err != nil {
+		log.Error(err, "Failed to fingerprint resource.", "name", targetStatus.Name, "namespace ", targetStatus.Namespace)
+		targetStatus.Message = err.Error()
+		return targetStatus, false, false, permanent(err)
+	}
+
+	existingTarget, err := getTargetResource(r, resourceHandler, targetResource)
+	if err != nil {
+		log.Error(err, "Failed to get target resource.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
+		targetStatus.Message = err.Error()
+		return targetStatus, false, false, err
+	}
+
+	if existingTarget == nil {
+		err = r.Client.Create(context.TODO(), targetResource)
+		if err != nil {
+			log.Error(err, "Failed to create resource.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
+			r.recordTargetFailure(copyResource, targetResource, "create", err)
+			recordCopy(targetResource, copyResultFailed)
+			targetStatus.Message = err.Error()
+			return targetStatus, false, false, err
+		}
+		log.Info("Successfully created.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
+		r.recordTargetEvent(copyResource, targetResource, v1.EventTypeNormal, EventReasonCreated, "Created", nil)
+		recordCopy(targetResource, copyResultCreated)
+		written = true
+	} else {
+		err = checkConflict(existingTarget, copyResource, competitors)
+		if err != nil {
+			log.Info("Target resource conflict.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace(), "reason", err.Error())
+			r.recordTargetFailure(copyResource, existingTarget, "copy", err)
+			recordCopy(targetResource, copyResultFailed)
+			targetStatus.Message = err.Error()
+			return targetStatus, false, false, err
+		}
+
+		sourceChanged := targetStatus.ResourceVersion != sourceResource.GetResourceVersion() ||
+			targetStatus.Fingerprint != fingerprint
+		drifted = !sourceChanged && !resourceHandler.Compare(targetResource, existingTarget)
+		if drifted {
+			log.Info("Drift detected, restoring target resource.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
+		}
+
+		if sourceChanged || drifted || !isOwnedBy(existingTarget, copyResource) {
+			targetResource.SetResourceVersion(existingTarget.GetResourceVersion())
 			err = r.Client.Update(context.TODO(), targetResource)
 			if err != nil {
 				log.Error(err, "Failed to update.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
-				return ctrl.Result{}, nil
+				r.recordTargetFailure(copyResource, existingTarget, "update", err)
+				recordCopy(targetResource, copyResultFailed)
+				targetStatus.Message = err.Error()
+				return targetStatus, false, drifted, err
 			}
 			log.Info("Successfully update.", "name", targetResource.GetName(), "namespace ", targetResource.GetNamespace())
-		}
-
-		copyResource.Status.ResourceVersion = getResourceVersion(copyResource.Spec.Kind, sourceResource)
-		err := r.Status().Update(context.TODO(), copyResource)
-		if err != nil {
-			log.Error(err, "Failed to update CopyResource status.", "resourceVersion", copyResource.Status.ResourceVersion)
-			return ctrl.Result{}, nil
+			if drifted {
+				r.recordTargetEvent(copyResource, targetResource, v1.EventTypeWarning, EventReasonRestored, "Restored modified", nil)
+			} else {
+				r.recordTargetEvent(copyResource, targetResource, v1.EventTypeNormal, EventReasonUpdated, "Updated", nil)
+			}
+			recordCopy(targetResource, copyResultUpdated)
+			if targetStatus.ResourceVersion != "" && targetStatus.ResourceVersion != sourceResource.GetResourceVersion() {
+				recordPropagationLag(sourceResource)
+			}
+			written = true
 		}
 	}
 
-	return ctrl.Result{}, nil
+	targetStatus.ResourceVersion = sourceResource.GetResourceVersion()
+	targetStatus.Fingerprint = fingerprint
+	targetStatus.Synced = true
+	return targetStatus, written, drifted, nil
 }
 
 func (r *CopyResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Handlers == nil {
+		r.Handlers = NewResourceHandlerRegistry()
+	}
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("os3-copier")
+	}
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+	err := registerCopyResourceCollector(mgr.GetClient(), r.Log)
+	if err != nil {
+		return err
+	}
+
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &resourcebaloisechv1alpha1.CopyResource{}, sourceIndexKey,
+		func(object runtime.Object) []string {
+			copyResource := object.(*resourcebaloisechv1alpha1.CopyResource)
+			var values []string
+			for _, name := range getSourceNames(copyResource) {
+				values = append(values, sourceIndexValue(copyResource.Spec.Kind, getSourceNamespace(copyResource), name))
+			}
+			return values
+		})
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &resourcebaloisechv1alpha1.CopyResource{}, sourceNamespaceIndexKey,
+		func(object runtime.Object) []string {
+			return []string{getSourceNamespace(object.(*resourcebaloisechv1alpha1.CopyResource))}
+		})
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.TODO(), &resourcebaloisechv1alpha1.CopyResource{}, targetIndexKey,
+		func(object runtime.Object) []string {
+			return targetIndexValues(object.(*resourcebaloisechv1alpha1.CopyResource))
+		})
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&resourcebaloisechv1alpha1.CopyResource{}).
+		Watches(&source.Kind{Type: &resourcebaloisechv1alpha1.CopyResource{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapCopyResourceToCompetitors),
+		}).
+		Watches(&source.Kind{Type: &resourcebaloisechv1alpha1.CopyGrant{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapCopyGrantToCopyResources),
+		}).
+		Watches(&source.Kind{Type: &resourcebaloisechv1alpha1.CopyPolicy{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapCopyPolicyToCopyResources),
+		}).
+		Watches(&source.Kind{Type: &v1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapNamespaceToCopyResources),
+		}).
+		Watches(&source.Kind{Type: &v1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapResourceToCopyResources("Secret")),
+		}).
+		Watches(&source.Kind{Type: &v1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapResourceToCopyResources("ConfigMap")),
+		}).
 		Complete(r)
 }
 
-func isObjectExists(r *CopyResourceReconciler, targetResource Object, log logr.Logger) bool {
+// mapResourceToCopyResources returns a mapper enqueuing all CopyResources referencing the changed Resource of kind,
+// either as their source or as one of their targets
+func (r *CopyResourceReconciler) mapResourceToCopyResources(kind string) func(handler.MapObject) []reconcile.Request {
+	return func(resource handler.MapObject) []reconcile.Request {
+		copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+		err := r.List(context.TODO(), copyResources,
+			client.MatchingFields{sourceIndexKey: sourceIndexValue(kind, resource.Meta.GetNamespace(), resource.Meta.GetName())})
+		if err != nil {
+			r.Log.Error(err, "Failed to list CopyResources.", "kind", kind, "name", resource.Meta.GetName(), "namespace", resource.Meta.GetNamespace())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, copyResource := range copyResources.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: copyResource.Namespace,
+				Name:      copyResource.Name,
+			}})
+		}
+		if len(requests) > 0 {
+			observeSourceChange(kind, resource.Meta.GetNamespace(), resource.Meta.GetName(), resource.Meta.GetResourceVersion())
+		}
+
+		if owner, ok := getOwner(resource.Meta); ok {
+			requests = append(requests, reconcile.Request{NamespacedName: owner})
+		}
+		return requests
+	}
+}
+
+// mapNamespaceToCopyResources enqueues all CopyResources whose TargetNamespaceSelector matches the namespace
+func (r *CopyResourceReconciler) mapNamespaceToCopyResources(namespace handler.MapObject) []reconcile.Request {
+	copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+	err := r.List(context.TODO(), copyResources)
+	if err != nil {
+		r.Log.Error(err, "Failed to list CopyResources.", "namespace", namespace.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, copyResource := range copyResources.Items {
+		if copyResource.Spec.TargetNamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(copyResource.Spec.TargetNamespaceSelector)
+		if err != nil {
+			r.Log.Error(err, "Invalid targetNamespaceSelector.", "name", copyResource.Name, "namespace", copyResource.Namespace)
+			continue
+		}
+		if selector.Matches(labels.Set(namespace.Meta.GetLabels())) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: copyResource.Namespace,
+				Name:      copyResource.Name,
+			}})
+		}
+	}
+	return requests
+}
+
+// getTargetResource returns the existing target Resource or nil if it does not exist
+func getTargetResource(r *CopyResourceReconciler, resourceHandler ResourceHandler, targetResource *unstructured.Unstructured) (*unstructured.Unstructured, error) {
 	targetNamespacedName := types.NamespacedName{
 		Namespace: targetResource.GetNamespace(),
 		Name:      targetResource.GetName(),
 	}
 	// Use an unstructured type to avoid cache reader
-	u := &unstructured.Unstructured{}
-	u.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "",
-		Kind:    targetResource.GetObjectKind().GroupVersionKind().Kind,
-		Version: "v1",
-	})
-	err := r.Client.Get(context.TODO(), targetNamespacedName, u)
+	existingTarget := resourceHandler.NewObject(targetResource.GroupVersionKind())
+	err := r.Client.Get(context.TODO(), targetNamespacedName, existingTarget)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			log.Info("Not found " + targetNamespacedName.Namespace + "/" + targetNamespacedName.Name)
+			return nil, nil
 		}
-		return false
+		return nil, err
 	}
-	return true
+	return existingTarget, nil
+}
+
+func (r *CopyResourceReconciler) getResourceHandler(gvk schema.GroupVersionKind) ResourceHandler {
+	return r.Handlers.Get(gvk.GroupKind())
 }
 
-func StringToStruct(kind string) (Object, error) {
-	switch kind {
-	case "Secret":
-		return &v1.Secret{}, nil
-	case "ConfigMap":
-		return &v1.ConfigMap{}, nil
-	default:
-		return nil, fmt.Errorf("%s is not a known resource kind", kind)
+// getGroupVersionKind returns the GroupVersionKind of the source Resource, the APIVersion defaults to v1
+func getGroupVersionKind(copyResource *resourcebaloisechv1alpha1.CopyResource) (schema.GroupVersionKind, error) {
+	apiVersion := copyResource.Spec.APIVersion
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
 	}
+	return groupVersion.WithKind(copyResource.Spec.Kind), nil
 }
 
-func cloneResource(kind string, source Object, target Object) (Object, error) {
-	switch kind {
-	case "Secret":
-		sourceSecret := source.(*v1.Secret)
-		copier.Copy(target.(*v1.Secret), sourceSecret)
-		return target, nil
-	case "ConfigMap":
-		sourceConfigMap := source.(*v1.ConfigMap)
-		copier.Copy(target.(*v1.ConfigMap), sourceConfigMap)
-		return target, nil
-	default:
-		return nil, fmt.Errorf("%s is not a known resource kind", kind)
+// getTargetNamespaces returns the distinct namespaces of TargetNamespace, TargetNamespaces
+// and all active namespaces matching TargetNamespaceSelector
+func (r *CopyResourceReconciler) getTargetNamespaces(copyResource *resourcebaloisechv1alpha1.CopyResource) ([]string, error) {
+	candidates := append([]string{copyResource.Spec.TargetNamespace}, copyResource.Spec.TargetNamespaces...)
+
+	if copyResource.Spec.TargetNamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(copyResource.Spec.TargetNamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		namespaceList := &v1.NamespaceList{}
+		err = r.List(context.TODO(), namespaceList, client.MatchingLabelsSelector{Selector: selector})
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaceList.Items {
+			if namespace.Status.Phase != v1.NamespaceTerminating {
+				candidates = append(candidates, namespace.Name)
+			}
+		}
+	}
+
+	namespaces := make([]string, 0)
+	seen := map[string]bool{}
+	for _, namespace := range candidates {
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		// Never overwrite a source Resource itself
+		if namespace == getSourceNamespace(copyResource) && containsString(getSourceNames(copyResource), getTargetName(copyResource)) {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
 	}
+	return namespaces, nil
 }
 
-func buildOwnerReferenceToCopyResource(copyResource *resourcebaloisechv1alpha1.CopyResource) metav1.OwnerReference {
-	return metav1.OwnerReference{
-		APIVersion: copyResource.APIVersion,
-		Kind:       copyResource.Kind,
-		Name:       copyResource.GetName(),
-		UID:        copyResource.GetUID(),
-		// If true, this reference points to the managing controller.
-		Controller: BoolPointer(true),
-		// Don't block owner deletion (CopyResource) if this resource still exists
-		BlockOwnerDeletion: BoolPointer(false),
+// ValidateTargets returns an error if the CopyResource sets none of TargetNamespace, TargetNamespaces and TargetNamespaceSelector
+func ValidateTargets(copyResource *resourcebaloisechv1alpha1.CopyResource) error {
+	if copyResource.Spec.TargetNamespaceSelector != nil {
+		return nil
+	}
+	for _, namespace := range append([]string{copyResource.Spec.TargetNamespace}, copyResource.Spec.TargetNamespaces...) {
+		if namespace != "" {
+			return nil
+		}
 	}
+	return fmt.Errorf("no target namespace set, set targetNamespace, targetNamespaces or targetNamespaceSelector")
+}
+
+func sourceIndexValue(kind string, namespace string, metaName string) string {
+	return kind + "/" + namespace + "/" + metaName
 }
 
-func sourceResourceVersionHasChanged(kind string, copyResourceVersion string, source Object) bool {
-	sourceResourceVersion := getResourceVersion(kind, source)
-	return sourceResourceVersion != copyResourceVersion
+func getTargetName(copyResource *resourcebaloisechv1alpha1.CopyResource) string {
+	if copyResource.Spec.TargetName != "" {
+		return copyResource.Spec.TargetName
+	}
+	return copyResource.Namespace + "-" + copyResource.Name
+}
+
+func findTargetStatus(targets []resourcebaloisechv1alpha1.TargetStatus, namespace string) *resourcebaloisechv1alpha1.TargetStatus {
+	for i := range targets {
+		if targets[i].Namespace == namespace {
+			return &targets[i]
+		}
+	}
+	return nil
+}
+
+// setAnnotation sets an annotation on a copy of the objects annotations, as they may be shared with the source Resource
+func setAnnotation(object metav1.Object, key string, value string) {
+	annotations := map[string]string{}
+	for k, v := range object.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[key] = value
+	object.SetAnnotations(annotations)
 }
 
-func getResourceVersion(kind string, resource Object) string {
-	switch kind {
-	case "Secret":
-		return resource.(*v1.Secret).ResourceVersion
-	case "ConfigMap":
-		return resource.(*v1.ConfigMap).ResourceVersion
-	default:
-		return ""
+// setLabel sets a label on a copy of the objects labels, as they may be shared with the source Resource
+func setLabel(object metav1.Object, key string, value string) {
+	objectLabels := map[string]string{}
+	for k, v := range object.GetLabels() {
+		objectLabels[k] = v
 	}
+	objectLabels[key] = value
+	object.SetLabels(objectLabels)
 }
 
 func BoolPointer(b bool) *bool {
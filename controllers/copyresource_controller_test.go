@@ -0,0 +1,220 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+var testCreationTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestReconciler returns a CopyResourceReconciler backed by a fake client holding the given objects
+func newTestReconciler(objects ...runtime.Object) *CopyResourceReconciler {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = resourcebaloisechv1alpha1.AddToScheme(scheme)
+	return &CopyResourceReconciler{
+		Client:   &indexedClient{Client: fake.NewFakeClientWithScheme(scheme, objects...)},
+		Log:      logf.NullLogger{},
+		Scheme:   scheme,
+		Handlers: NewResourceHandlerRegistry(),
+		Recorder: record.NewFakeRecorder(100),
+	}
+}
+
+// newTestCopyResource returns a CopyResource of the Secret "registry" in the namespace "source",
+// created the given number of seconds after testCreationTime
+func newTestCopyResource(namespace string, name string, createdAfter int, conflictPolicy resourcebaloisechv1alpha1.ConflictPolicy) *resourcebaloisechv1alpha1.CopyResource {
+	return &resourcebaloisechv1alpha1.CopyResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			UID:               types.UID(namespace + "-" + name),
+			CreationTimestamp: metav1.NewTime(testCreationTime.Add(time.Duration(createdAfter) * time.Second)),
+		},
+		Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+			Kind:            "Secret",
+			SourceNamespace: "source",
+			MetaName:        "registry",
+			TargetName:      "registry",
+			ConflictPolicy:  conflictPolicy,
+		},
+	}
+}
+
+// newTestTarget returns the Secret "registry" in the namespace "target", owned by the given CopyResource if not nil
+func newTestTarget(owner *resourcebaloisechv1alpha1.CopyResource, data map[string][]byte) *v1.Secret {
+	target := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "target", Name: "registry", ResourceVersion: "5"},
+		Type:       v1.SecretTypeOpaque,
+		Data:       data,
+	}
+	if owner != nil {
+		setOwnership(target, owner)
+	}
+	return target
+}
+
+// prepareTestTarget returns the source Secret with the given data and its sanitized copy
+func prepareTestTarget(t *testing.T, r *CopyResourceReconciler, resourceVersion string, data map[string]interface{}) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	source := newTestObject("Secret", "registry", resourceVersion, map[string]interface{}{"type": "Opaque", "data": data})
+	handler := r.getResourceHandler(source.GroupVersionKind())
+	preparedTarget, err := handler.Clone(source)
+	if err != nil {
+		t.Fatalf("Clone() error = %v", err)
+	}
+	err = handler.Sanitize(preparedTarget, nil)
+	if err != nil {
+		t.Fatalf("Sanitize() error = %v", err)
+	}
+	return source, preparedTarget
+}
+
+func TestCopyToTarget(t *testing.T) {
+	copyResource := newTestCopyResource("team", "registry", 0, "")
+	tests := []struct {
+		name           string
+		conflictPolicy resourcebaloisechv1alpha1.ConflictPolicy
+		target         *v1.Secret
+		synced         *resourcebaloisechv1alpha1.TargetStatus
+		wantWritten    bool
+		wantDrifted    bool
+		wantData       map[string][]byte
+		wantUnchanged  bool
+	}{
+		{
+			name:        "creates a missing target",
+			wantWritten: true,
+			wantData:    map[string][]byte{"token": []byte("new")},
+		},
+		{
+			name:        "updates the target of a changed source",
+			target:      newTestTarget(copyResource, map[string][]byte{"token": []byte("old")}),
+			synced:      &resourcebaloisechv1alpha1.TargetStatus{Namespace: "target", Name: "registry", ResourceVersion: "1"},
+			wantWritten: true,
+			wantData:    map[string][]byte{"token": []byte("new")},
+		},
+		{
+			name:           "adopts an unmanaged target",
+			conflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyAdopt,
+			target:         newTestTarget(nil, map[string][]byte{"token": []byte("new")}),
+			wantWritten:    true,
+			wantData:       map[string][]byte{"token": []byte("new")},
+		},
+		{
+			name:        "restores a modified target",
+			target:      newTestTarget(copyResource, map[string][]byte{"token": []byte("modified")}),
+			synced:      &resourcebaloisechv1alpha1.TargetStatus{Namespace: "target", Name: "registry", ResourceVersion: "2"},
+			wantWritten: true,
+			wantDrifted: true,
+			wantData:    map[string][]byte{"token": []byte("new")},
+		},
+		{
+			name:          "leaves a synced target untouched",
+			target:        newTestTarget(copyResource, map[string][]byte{"token": []byte("new")}),
+			synced:        &resourcebaloisechv1alpha1.TargetStatus{Namespace: "target", Name: "registry", ResourceVersion: "2"},
+			wantData:      map[string][]byte{"token": []byte("new")},
+			wantUnchanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copyResource := copyResource.DeepCopy()
+			copyResource.Spec.ConflictPolicy = tt.conflictPolicy
+			var objects []runtime.Object
+			if tt.target != nil {
+				objects = append(objects, tt.target)
+			}
+			r := newTestReconciler(objects...)
+			source, preparedTarget := prepareTestTarget(t, r, "2", map[string]interface{}{"token": encode("new")})
+			handler := r.getResourceHandler(source.GroupVersionKind())
+			if tt.synced != nil {
+				fingerprint, err := handler.Fingerprint(withOwnership(preparedTarget, copyResource))
+				if err != nil {
+					t.Fatalf("Fingerprint() error = %v", err)
+				}
+				tt.synced.Fingerprint = fingerprint
+				copyResource.Status.Targets = []resourcebaloisechv1alpha1.TargetStatus{*tt.synced}
+			}
+
+			status, written, drifted, err := r.copyToTarget(copyResource, handler, source, preparedTarget, "target", r.Log)
+			if err != nil {
+				t.Fatalf("copyToTarget() error = %v", err)
+			}
+			if written != tt.wantWritten || drifted != tt.wantDrifted {
+				t.Errorf("copyToTarget() written = %v, drifted = %v, want %v, %v", written, drifted, tt.wantWritten, tt.wantDrifted)
+			}
+			if !status.Synced || status.ResourceVersion != "2" {
+				t.Errorf("copyToTarget() status = %+v, want synced resourceVersion 2", status)
+			}
+
+			target := &v1.Secret{}
+			err = r.Get(context.TODO(), types.NamespacedName{Namespace: "target", Name: "registry"}, target)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !reflect.DeepEqual(target.Data, tt.wantData) {
+				t.Errorf("target data = %v, want %v", target.Data, tt.wantData)
+			}
+			if !isOwnedBy(target, copyResource) {
+				t.Errorf("target is not owned by the CopyResource: %+v", target.ObjectMeta)
+			}
+			if tt.wantUnchanged && target.ResourceVersion != tt.target.ResourceVersion {
+				t.Errorf("target resourceVersion = %s, want unchanged %s", target.ResourceVersion, tt.target.ResourceVersion)
+			}
+		})
+	}
+}
+
+func withOwnership(preparedTarget *unstructured.Unstructured, copyResource *resourcebaloisechv1alpha1.CopyResource) *unstructured.Unstructured {
+	target := preparedTarget.DeepCopy()
+	target.SetNamespace("target")
+	target.SetName(getTargetName(copyResource))
+	setOwnership(target, copyResource)
+	return target
+}
+
+func TestSyncTargetsWithoutTargetNamespace(t *testing.T) {
+	copyResource := newTestCopyResource("team", "registry", 0, "")
+	copyResource.Spec.TargetNamespaces = []string{""}
+	r := newTestReconciler(copyResource)
+	status := &resourcebaloisechv1alpha1.CopyResourceStatus{}
+
+	_, err := r.syncTargets(copyResource, status, r.Log)
+	if err == nil || isTransient(err) {
+		t.Fatalf("syncTargets() error = %v, want permanent error", err)
+	}
+	condition := findCondition(status.Conditions, resourcebaloisechv1alpha1.ConditionTargetSynced)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != ReasonInvalidTargets {
+		t.Errorf("TargetSynced condition = %+v, want False with reason %s", condition, ReasonInvalidTargets)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// SetDefaults writes all defaults the controller otherwise applies implicitly into the spec of the CopyResource,
+// so the stored spec shows what the controller does and later changes of the defaults don't affect it.
+// An empty TargetKind is kept, as it follows later changes of the Kind.
+func SetDefaults(copyResource *resourcebaloisechv1alpha1.CopyResource) {
+	spec := &copyResource.Spec
+	if spec.APIVersion == "" {
+		spec.APIVersion = "v1"
+	}
+	// The default TargetName derives from the name, which is not known yet for objects created with generateName
+	if copyResource.Name != "" {
+		spec.TargetName = getTargetName(copyResource)
+	}
+	spec.DeletionPolicy = getDeletionPolicy(copyResource)
+	spec.ConflictPolicy = getConflictPolicy(copyResource)
+	if len(spec.Sources) > 0 {
+		spec.MergeStrategy = getMergeStrategy(copyResource)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// CleanupFinalizer blocks the deletion of a CopyResource with DeletionPolicy Delete until its targets are deleted
+const CleanupFinalizer = "copier.baloise.ch/cleanup"
+
+// reconcileFinalizer adds or removes the CleanupFinalizer according to the DeletionPolicy of the CopyResource
+func (r *CopyResourceReconciler) reconcileFinalizer(copyResource *resourcebaloisechv1alpha1.CopyResource) error {
+	hasFinalizer := containsString(copyResource.GetFinalizers(), CleanupFinalizer)
+	if getDeletionPolicy(copyResource) == resourcebaloisechv1alpha1.DeletionPolicyDelete {
+		if hasFinalizer {
+			return nil
+		}
+		copyResource.SetFinalizers(append(copyResource.GetFinalizers(), CleanupFinalizer))
+	} else {
+		if !hasFinalizer {
+			return nil
+		}
+		copyResource.SetFinalizers(removeString(copyResource.GetFinalizers(), CleanupFinalizer))
+	}
+	return r.Update(context.TODO(), copyResource)
+}
+
+// finalize deletes all target Resources of a CopyResource which is being deleted and releases the CleanupFinalizer
+func (r *CopyResourceReconciler) finalize(copyResource *resourcebaloisechv1alpha1.CopyResource, log logr.Logger) error {
+	if !containsString(copyResource.GetFinalizers(), CleanupFinalizer) {
+		return nil
+	}
+
+	if getDeletionPolicy(copyResource) == resourcebaloisechv1alpha1.DeletionPolicyDelete {
+		gvk, err := GetTargetGroupVersionKind(copyResource)
+		if err != nil {
+			log.Error(err, "Invalid kind.", "apiVersion", copyResource.Spec.APIVersion, "kind", copyResource.Spec.Kind, "targetKind", copyResource.Spec.TargetKind)
+			return err
+		}
+		targets, err := listOwnedTargets(r.Client, gvk, client.MatchingLabels{CopyResourceUIDLabel: string(copyResource.UID)})
+		if err != nil {
+			log.Error(err, "Failed to list target resources.")
+			return err
+		}
+		for i := range targets {
+			err = r.Client.Delete(context.TODO(), &targets[i])
+			if err != nil && !errors.IsNotFound(err) {
+				log.Error(err, "Failed to delete target resource.", "name", targets[i].GetName(), "namespace ", targets[i].GetNamespace())
+				r.recordTargetFailure(copyResource, &targets[i], "delete", err)
+				return err
+			}
+			log.Info("Successfully deleted.", "name", targets[i].GetName(), "namespace ", targets[i].GetNamespace())
+			r.recordEvent(copyResource, v1.EventTypeNormal, EventReasonDeleted, "Deleted %s %s/%s", targets[i].GetKind(), targets[i].GetNamespace(), targets[i].GetName())
+		}
+	}
+
+	copyResource.SetFinalizers(removeString(copyResource.GetFinalizers(), CleanupFinalizer))
+	return r.Update(context.TODO(), copyResource)
+}
+
+func getDeletionPolicy(copyResource *resourcebaloisechv1alpha1.CopyResource) resourcebaloisechv1alpha1.DeletionPolicy {
+	if copyResource.Spec.DeletionPolicy == "" {
+		return resourcebaloisechv1alpha1.DeletionPolicyOrphan
+	}
+	return copyResource.Spec.DeletionPolicy
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(slice []string, s string) []string {
+	var result []string
+	for _, item := range slice {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
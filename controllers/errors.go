@@ -0,0 +1,69 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// permanentError marks an error which will not resolve by retrying, e.g. an invalid CopyResource
+type permanentError struct {
+	error
+}
+
+// permanent marks err as permanent
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// isTransient returns true if err may resolve by retrying, e.g. timeouts, conflicts or an unavailable API server.
+// Transient errors are returned to the workqueue which retries them with exponential backoff,
+// permanent errors are only reported in the status until the CopyResource or the cluster changes.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(permanentError); ok {
+		return false
+	}
+	if isConflict(err) {
+		return false
+	}
+	switch {
+	case errors.IsForbidden(err),
+		errors.IsUnauthorized(err),
+		errors.IsInvalid(err),
+		errors.IsBadRequest(err),
+		errors.IsMethodNotSupported(err),
+		errors.IsRequestEntityTooLargeError(err),
+		meta.IsNoMatchError(err):
+		return false
+	}
+	return true
+}
+
+// requeueError returns err if it is transient so the workqueue retries with backoff, otherwise nil
+func requeueError(err error) error {
+	if isTransient(err) {
+		return err
+	}
+	return nil
+}
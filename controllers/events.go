@@ -0,0 +1,69 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// The Reasons of the Events recorded on CopyResources, annotated source Resources and target Resources
+const (
+	EventReasonCreated           = "Created"
+	EventReasonUpdated           = "Updated"
+	EventReasonRestored          = "Restored"
+	EventReasonDeleted           = "Deleted"
+	EventReasonSourceNotFound    = "SourceNotFound"
+	EventReasonSourceNotGranted  = "SourceNotGranted"
+	EventReasonTargetConflict    = "TargetConflict"
+	EventReasonForbidden         = "Forbidden"
+	EventReasonSyncFailed        = "SyncFailed"
+	EventReasonInvalidAnnotation = "InvalidAnnotation"
+)
+
+// recordEvent records an Event on the CopyResource
+func (r *CopyResourceReconciler) recordEvent(copyResource *resourcebaloisechv1alpha1.CopyResource, eventType string, reason string, messageFmt string, args ...interface{}) {
+	r.Recorder.Eventf(copyResource, eventType, reason, messageFmt, args...)
+}
+
+// recordTargetEvent records an Event about an action on the target Resource on the CopyResource
+// and, if enabled, on the target Resource itself
+func (r *CopyResourceReconciler) recordTargetEvent(copyResource *resourcebaloisechv1alpha1.CopyResource, target *unstructured.Unstructured, eventType string, reason string, action string, err error) {
+	suffix := ""
+	if err != nil {
+		suffix = ": " + err.Error()
+	}
+	r.recordEvent(copyResource, eventType, reason, "%s %s %s/%s%s", action, target.GetKind(), target.GetNamespace(), target.GetName(), suffix)
+	if r.TargetEventsEnabled && target.GetUID() != "" {
+		r.Recorder.Eventf(target, eventType, reason, "%s by CopyResource %s/%s%s", action, copyResource.Namespace, copyResource.Name, suffix)
+	}
+}
+
+// recordTargetFailure records a Warning Event about a failed action with a reason derived from err
+func (r *CopyResourceReconciler) recordTargetFailure(copyResource *resourcebaloisechv1alpha1.CopyResource, target *unstructured.Unstructured, action string, err error) {
+	reason := EventReasonSyncFailed
+	switch {
+	case errors.IsForbidden(err):
+		reason = EventReasonForbidden
+	case isConflict(err), errors.IsConflict(err), errors.IsAlreadyExists(err):
+		reason = EventReasonTargetConflict
+	}
+	r.recordTargetEvent(copyResource, target, v1.EventTypeWarning, reason, "Failed to "+action, err)
+}
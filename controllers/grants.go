@@ -0,0 +1,110 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// sourceNamespaceIndexKey is the field index of CopyResources by the namespace of their source Resources
+const sourceNamespaceIndexKey = ".spec.sourceNamespace"
+
+// getSourceNamespace returns the namespace of the source Resources, which defaults to the namespace of the CopyResource
+func getSourceNamespace(copyResource *resourcebaloisechv1alpha1.CopyResource) string {
+	if copyResource.Spec.SourceNamespace != "" {
+		return copyResource.Spec.SourceNamespace
+	}
+	return copyResource.Namespace
+}
+
+// checkGrants returns an error naming all sources of another namespace which no CopyGrant permits the CopyResource to copy
+func (r *CopyResourceReconciler) checkGrants(copyResource *resourcebaloisechv1alpha1.CopyResource, gvk schema.GroupVersionKind) error {
+	sourceNamespace := getSourceNamespace(copyResource)
+	if sourceNamespace == copyResource.Namespace {
+		return nil
+	}
+
+	copyGrants := &resourcebaloisechv1alpha1.CopyGrantList{}
+	err := r.APIReader.List(context.TODO(), copyGrants, client.InNamespace(sourceNamespace))
+	if err != nil {
+		return err
+	}
+
+	var denied []string
+	for _, name := range getSourceNames(copyResource) {
+		if !isGranted(copyGrants.Items, copyResource.Namespace, gvk.GroupKind(), name) {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) > 0 {
+		return permanent(fmt.Errorf("no CopyGrant in namespace %s permits namespace %s to copy %s %s",
+			sourceNamespace, copyResource.Namespace, gvk.Kind, strings.Join(denied, ", ")))
+	}
+	return nil
+}
+
+// isGranted returns true if any of the CopyGrants permits the namespace to copy the named Resource of groupKind.
+// The namespaces, kinds and names of the CopyGrants are exact names or globs.
+func isGranted(copyGrants []resourcebaloisechv1alpha1.CopyGrant, namespace string, groupKind schema.GroupKind, name string) bool {
+	for _, copyGrant := range copyGrants {
+		fromMatches := false
+		for _, from := range copyGrant.Spec.From {
+			if matchesPattern(from.Namespace, namespace) {
+				fromMatches = true
+				break
+			}
+		}
+		if !fromMatches {
+			continue
+		}
+		for _, to := range copyGrant.Spec.To {
+			if to.Group == groupKind.Group && matchesPattern(to.Kind, groupKind.Kind) && (to.Name == "" || matchesPattern(to.Name, name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapCopyGrantToCopyResources enqueues all CopyResources copying from the namespace of the changed CopyGrant
+func (r *CopyResourceReconciler) mapCopyGrantToCopyResources(copyGrant handler.MapObject) []reconcile.Request {
+	copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+	err := r.List(context.TODO(), copyResources, client.MatchingFields{sourceNamespaceIndexKey: copyGrant.Meta.GetNamespace()})
+	if err != nil {
+		r.Log.Error(err, "Failed to list CopyResources.", "namespace", copyGrant.Meta.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, copyResource := range copyResources.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: copyResource.Namespace,
+			Name:      copyResource.Name,
+		}})
+	}
+	return requests
+}
@@ -0,0 +1,148 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+func newTestCopyGrant(from []string, to ...resourcebaloisechv1alpha1.CopyGrantTo) resourcebaloisechv1alpha1.CopyGrant {
+	copyGrant := resourcebaloisechv1alpha1.CopyGrant{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "grant"},
+		Spec:       resourcebaloisechv1alpha1.CopyGrantSpec{To: to},
+	}
+	for _, namespace := range from {
+		copyGrant.Spec.From = append(copyGrant.Spec.From, resourcebaloisechv1alpha1.CopyGrantFrom{Namespace: namespace})
+	}
+	return copyGrant
+}
+
+func TestIsGranted(t *testing.T) {
+	secret := schema.GroupKind{Kind: "Secret"}
+	tests := []struct {
+		name       string
+		copyGrants []resourcebaloisechv1alpha1.CopyGrant
+		groupKind  schema.GroupKind
+		want       bool
+	}{
+		{
+			name:      "no CopyGrants",
+			groupKind: secret,
+		},
+		{
+			name:       "exact match",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret", Name: "shared-ca"})},
+			groupKind:  secret,
+			want:       true,
+		},
+		{
+			name:       "empty name grants all names",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"})},
+			groupKind:  secret,
+			want:       true,
+		},
+		{
+			name:       "other namespace",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-b"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"})},
+			groupKind:  secret,
+		},
+		{
+			name:       "any of several namespaces",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-b", "team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"})},
+			groupKind:  secret,
+			want:       true,
+		},
+		{
+			name:       "namespace glob",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-*"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"})},
+			groupKind:  secret,
+			want:       true,
+		},
+		{
+			name:       "namespace glob of other namespaces",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"dev-*"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"})},
+			groupKind:  secret,
+		},
+		{
+			name:       "other kind",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "ConfigMap"})},
+			groupKind:  secret,
+		},
+		{
+			name:       "kind glob",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "*"})},
+			groupKind:  secret,
+			want:       true,
+		},
+		{
+			name:       "other group",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"})},
+			groupKind:  schema.GroupKind{Group: "example.com", Kind: "Secret"},
+		},
+		{
+			name:       "group and kind",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Group: "example.com", Kind: "Secret"})},
+			groupKind:  schema.GroupKind{Group: "example.com", Kind: "Secret"},
+			want:       true,
+		},
+		{
+			name:       "other name",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret", Name: "other"})},
+			groupKind:  secret,
+		},
+		{
+			name:       "name glob",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret", Name: "shared-*"})},
+			groupKind:  secret,
+			want:       true,
+		},
+		{
+			name:       "name glob of other names",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret", Name: "tls-*"})},
+			groupKind:  secret,
+		},
+		{
+			name: "namespace and resource need to match in the same CopyGrant",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{
+				newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "ConfigMap"}),
+				newTestCopyGrant([]string{"team-b"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"}),
+			},
+			groupKind: secret,
+		},
+		{
+			name: "any of several CopyGrants",
+			copyGrants: []resourcebaloisechv1alpha1.CopyGrant{
+				newTestCopyGrant([]string{"team-b"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret"}),
+				newTestCopyGrant([]string{"team-a"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "ConfigMap"}, resourcebaloisechv1alpha1.CopyGrantTo{Kind: "Secret", Name: "shared-ca"}),
+			},
+			groupKind: secret,
+			want:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGranted(tt.copyGrants, "team-a", tt.groupKind, "shared-ca"); got != tt.want {
+				t.Errorf("isGranted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// dataFields hold the keys of Secrets and ConfigMaps
+var dataFields = []string{"data", "stringData", "binaryData"}
+
+// keyMatcher matches a key of the copied data against an exact name, a glob or a regular expression
+type keyMatcher func(key string) bool
+
+// newKeyMatcher parses a key pattern. Patterns enclosed in slashes are regular expressions,
+// patterns containing *, ? or [ are globs and all other patterns match the key exactly.
+func newKeyMatcher(pattern string) (keyMatcher, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expression, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern %s: %v", pattern, err)
+		}
+		return expression.MatchString, nil
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %s: %v", pattern, err)
+		}
+		return func(key string) bool {
+			matched, _ := path.Match(pattern, key)
+			return matched
+		}, nil
+	}
+	return func(key string) bool {
+		return key == pattern
+	}, nil
+}
+
+// keyMatchers match a key if any of its keyMatchers matches
+type keyMatchers []keyMatcher
+
+// newKeyMatchers parses all key patterns
+func newKeyMatchers(patterns []string) (keyMatchers, error) {
+	var matchers keyMatchers
+	for _, pattern := range patterns {
+		matcher, err := newKeyMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+func (m keyMatchers) matches(key string) bool {
+	for _, matcher := range m {
+		if matcher(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyFilter selects the keys of the source data which are copied to the targets
+type keyFilter struct {
+	include keyMatchers
+	exclude keyMatchers
+}
+
+// newKeyFilter returns the keyFilter of the include and exclude key patterns
+func newKeyFilter(includeKeys []string, excludeKeys []string) (*keyFilter, error) {
+	include, err := newKeyMatchers(includeKeys)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := newKeyMatchers(excludeKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &keyFilter{include: include, exclude: exclude}, nil
+}
+
+// matches returns true if the key is included, all keys are included without IncludeKeys.
+// ExcludeKeys take precedence over IncludeKeys.
+func (f *keyFilter) matches(key string) bool {
+	if len(f.include) > 0 && !f.include.matches(key) {
+		return false
+	}
+	return !f.exclude.matches(key)
+}
+
+// apply removes all keys which don't match the filter from the data fields of the object
+func (f *keyFilter) apply(object *unstructured.Unstructured) {
+	for _, field := range dataFields {
+		data, ok := object.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range data {
+			if !f.matches(key) {
+				delete(data, key)
+			}
+		}
+	}
+}
+
+// keys returns the sorted keys of the data fields of the object which match the filter
+func (f *keyFilter) keys(object *unstructured.Unstructured) []string {
+	var keys []string
+	for _, field := range dataFields {
+		data, ok := object.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range data {
+			if f.matches(key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateKeyMappings returns the errors of KeyMappings which are invalid regardless of the source keys
+func validateKeyMappings(mappings []resourcebaloisechv1alpha1.KeyMapping) error {
+	var errs []string
+	fromOf := map[string]string{}
+	for _, mapping := range mappings {
+		if otherFrom, exists := fromOf[mapping.To]; exists {
+			errs = append(errs, fmt.Sprintf("source keys %s and %s are both mapped to target key %s", otherFrom, mapping.From, mapping.To))
+			continue
+		}
+		fromOf[mapping.To] = mapping.From
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid key mappings: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ValidateKeys returns the errors of the key filters, KeyMappings and Transform templates of the CopyResource
+// which are invalid regardless of the source keys
+func ValidateKeys(copyResource *resourcebaloisechv1alpha1.CopyResource) error {
+	_, err := getSources(copyResource)
+	if err != nil {
+		return err
+	}
+	targetGVK, err := GetTargetGroupVersionKind(copyResource)
+	if err != nil {
+		return err
+	}
+	_, err = newDataProcessor(copyResource, targetGVK)
+	return err
+}
+
+// mapKeys renames the keys of the data fields of the object according to the KeyMappings.
+// A source key mapped to several target keys is copied to each of them, unmapped keys are kept as they are.
+func mapKeys(object *unstructured.Unstructured, mappings []resourcebaloisechv1alpha1.KeyMapping) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	mapped := map[string]bool{}
+	for _, mapping := range mappings {
+		mapped[mapping.From] = true
+	}
+
+	result := map[string]map[string]interface{}{}
+	fieldOf := map[string]string{}
+	for _, field := range dataFields {
+		data, ok := object.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		result[field] = map[string]interface{}{}
+		for key, value := range data {
+			if !mapped[key] {
+				result[field][key] = value
+				fieldOf[key] = field
+			}
+		}
+	}
+
+	var errs []string
+	for _, mapping := range mappings {
+		field, value, found := findDataKey(object, mapping.From)
+		if !found {
+			errs = append(errs, fmt.Sprintf("source key %s not found", mapping.From))
+			continue
+		}
+		if otherField, exists := fieldOf[mapping.To]; exists {
+			errs = append(errs, fmt.Sprintf("target key %s of source key %s collides with %s key %s", mapping.To, mapping.From, otherField, mapping.To))
+			continue
+		}
+		result[field][mapping.To] = value
+		fieldOf[mapping.To] = field
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid key mappings: %s", strings.Join(errs, ", "))
+	}
+
+	for field, data := range result {
+		object.Object[field] = data
+	}
+	return nil
+}
+
+// findDataKey returns the data field holding the key and its value
+func findDataKey(object *unstructured.Unstructured, key string) (field string, value interface{}, found bool) {
+	for _, field := range dataFields {
+		data, ok := object.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := data[key]; ok {
+			return field, value, true
+		}
+	}
+	return "", nil, false
+}
+
+// dataProcessor prepares the data of a cloned source Resource for the targets
+type dataProcessor struct {
+	targetGVK  schema.GroupVersionKind
+	binaryKeys keyMatchers
+	filter     *keyFilter
+	mappings   []resourcebaloisechv1alpha1.KeyMapping
+	templates  map[string]*template.Template
+}
+
+// newDataProcessor returns the dataProcessor of the CopyResource, err is set if a key pattern or template is invalid
+func newDataProcessor(copyResource *resourcebaloisechv1alpha1.CopyResource, targetGVK schema.GroupVersionKind) (*dataProcessor, error) {
+	binaryKeys, err := newKeyMatchers(copyResource.Spec.BinaryKeys)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newKeyFilter(copyResource.Spec.IncludeKeys, copyResource.Spec.ExcludeKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = validateKeyMappings(copyResource.Spec.KeyMappings)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := parseTemplates(copyResource.Spec.Transform)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) > 0 && !isConvertible(targetGVK.GroupKind()) {
+		return nil, fmt.Errorf("transform is only supported for Secrets and ConfigMaps, not %s", targetGVK.Kind)
+	}
+	return &dataProcessor{
+		targetGVK:  targetGVK,
+		binaryKeys: binaryKeys,
+		filter:     filter,
+		mappings:   copyResource.Spec.KeyMappings,
+		templates:  templates,
+	}, nil
+}
+
+// process filters the keys of the object, converts it to the target kind, renames its keys and renders the Transform
+// templates, which have access to all keys of the unfiltered object. Excluded keys are never converted.
+func (p *dataProcessor) process(object *unstructured.Unstructured) error {
+	var values *templateContext
+	var err error
+	if len(p.templates) > 0 {
+		values, err = newTemplateContext(object)
+		if err != nil {
+			return err
+		}
+	}
+	p.filter.apply(object)
+	err = convert(object, p.targetGVK, p.binaryKeys)
+	if err != nil {
+		return err
+	}
+	err = mapKeys(object, p.mappings)
+	if err != nil {
+		return err
+	}
+	return renderTemplates(object, p.templates, values)
+}
@@ -0,0 +1,227 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+func TestNewKeyMatcher(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		matches    []string
+		mismatches []string
+		wantErr    bool
+	}{
+		{pattern: "tls.crt", matches: []string{"tls.crt"}, mismatches: []string{"tlsxcrt", "tls.crt2"}},
+		{pattern: "*.crt", matches: []string{"tls.crt", ".crt"}, mismatches: []string{"tls.key", "tls.crt.bak"}},
+		{pattern: "key?", matches: []string{"key1"}, mismatches: []string{"key", "key12"}},
+		{pattern: "[ab].txt", matches: []string{"a.txt", "b.txt"}, mismatches: []string{"c.txt"}},
+		{pattern: "/^tls\\.(crt|key)$/", matches: []string{"tls.crt", "tls.key"}, mismatches: []string{"ca.crt", "tls.crt.bak"}},
+		{pattern: "/crt/", matches: []string{"tls.crt", "crt.pem"}, mismatches: []string{"tls.key"}},
+		{pattern: "/", matches: []string{"/"}, mismatches: []string{""}},
+		{pattern: "/(/", wantErr: true},
+		{pattern: "[a", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			matcher, err := newKeyMatcher(test.pattern)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, key := range test.matches {
+				if !matcher(key) {
+					t.Errorf("expected %s to match", key)
+				}
+			}
+			for _, key := range test.mismatches {
+				if matcher(key) {
+					t.Errorf("expected %s not to match", key)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		includeKeys []string
+		excludeKeys []string
+		want        []string
+	}{
+		{name: "all keys without patterns", want: []string{"ca.crt", "password", "tls.crt", "tls.key", "username"}},
+		{name: "included keys", includeKeys: []string{"tls.*", "username"}, want: []string{"tls.crt", "tls.key", "username"}},
+		{name: "excluded keys", excludeKeys: []string{"/^tls\\./"}, want: []string{"ca.crt", "password", "username"}},
+		{name: "exclude takes precedence", includeKeys: []string{"*.crt"}, excludeKeys: []string{"ca.crt"}, want: []string{"tls.crt"}},
+		{name: "nothing included", includeKeys: []string{"missing"}, want: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := newTestObject("Secret", "a", "1", map[string]interface{}{
+				"data":       map[string]interface{}{"tls.crt": "", "tls.key": "", "ca.crt": ""},
+				"stringData": map[string]interface{}{"username": "", "password": ""},
+			})
+			filter := mustKeyFilter(t, test.includeKeys, test.excludeKeys)
+			if got := filter.keys(object); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected keys %v, got %v", test.want, got)
+			}
+			filter.apply(object)
+			if got := (&keyFilter{}).keys(object); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected remaining keys %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewKeyFilterRejectsInvalidPatterns(t *testing.T) {
+	if _, err := newKeyFilter([]string{"/(/"}, nil); err == nil {
+		t.Error("expected an error for an invalid include pattern")
+	}
+	if _, err := newKeyFilter(nil, []string{"[a"}); err == nil {
+		t.Error("expected an error for an invalid exclude pattern")
+	}
+}
+
+func TestMapKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []resourcebaloisechv1alpha1.KeyMapping
+		want     map[string]interface{}
+		wantErr  string
+	}{
+		{
+			name: "no mappings",
+			want: map[string]interface{}{
+				"data":       map[string]interface{}{"tls.crt": "crt", "tls.key": "key"},
+				"stringData": map[string]interface{}{"username": "admin"},
+			},
+		},
+		{
+			name:     "keys are renamed within their field",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "tls.crt", To: "cert.pem"}, {From: "username", To: "user"}},
+			want: map[string]interface{}{
+				"data":       map[string]interface{}{"cert.pem": "crt", "tls.key": "key"},
+				"stringData": map[string]interface{}{"user": "admin"},
+			},
+		},
+		{
+			name:     "a key is copied to several target keys",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "tls.crt", To: "ca.crt"}, {From: "tls.crt", To: "ca.pem"}},
+			want: map[string]interface{}{
+				"data":       map[string]interface{}{"ca.crt": "crt", "ca.pem": "crt", "tls.key": "key"},
+				"stringData": map[string]interface{}{"username": "admin"},
+			},
+		},
+		{
+			name:     "keys are swapped",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "tls.crt", To: "tls.key"}, {From: "tls.key", To: "tls.crt"}},
+			want: map[string]interface{}{
+				"data":       map[string]interface{}{"tls.crt": "key", "tls.key": "crt"},
+				"stringData": map[string]interface{}{"username": "admin"},
+			},
+		},
+		{
+			name:     "missing source keys fail",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "missing", To: "x"}},
+			wantErr:  "source key missing not found",
+		},
+		{
+			name:     "target keys colliding with unmapped keys fail",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "tls.crt", To: "tls.key"}},
+			wantErr:  "target key tls.key of source key tls.crt collides with data key tls.key",
+		},
+		{
+			name:     "target keys colliding with other mappings fail",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "tls.crt", To: "x"}, {From: "username", To: "x"}},
+			wantErr:  "target key x of source key username collides with data key x",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := newTestObject("Secret", "a", "1", map[string]interface{}{
+				"data":       map[string]interface{}{"tls.crt": "crt", "tls.key": "key"},
+				"stringData": map[string]interface{}{"username": "admin"},
+			})
+			err := mapKeys(object, test.mappings)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := map[string]interface{}{"data": object.Object["data"], "stringData": object.Object["stringData"]}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateKeyMappings(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []resourcebaloisechv1alpha1.KeyMapping
+		wantErr  string
+	}{
+		{name: "no mappings"},
+		{name: "distinct target keys", mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "a", To: "x"}, {From: "a", To: "y"}}},
+		{
+			name:     "duplicate target keys",
+			mappings: []resourcebaloisechv1alpha1.KeyMapping{{From: "a", To: "x"}, {From: "b", To: "x"}},
+			wantErr:  "source keys a and b are both mapped to target key x",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateKeyMappings(test.mappings)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMapKeysKeepsObjectOnError(t *testing.T) {
+	object := newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"a": "1"}})
+	want := object.DeepCopy()
+	if err := mapKeys(object, []resourcebaloisechv1alpha1.KeyMapping{{From: "missing", To: "b"}}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !reflect.DeepEqual(object, want) {
+		t.Errorf("expected the object to be unchanged, got %v", object.Object)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// sourceRef is one source Resource of a CopyResource with its key filter
+type sourceRef struct {
+	name   string
+	filter *keyFilter
+}
+
+// getSources returns the MetaName followed by all Sources of the CopyResource, err is set if a key pattern is invalid
+func getSources(copyResource *resourcebaloisechv1alpha1.CopyResource) ([]sourceRef, error) {
+	var sources []sourceRef
+	if copyResource.Spec.MetaName != "" {
+		sources = append(sources, sourceRef{name: copyResource.Spec.MetaName, filter: &keyFilter{}})
+	}
+	for _, source := range copyResource.Spec.Sources {
+		filter, err := newKeyFilter(source.IncludeKeys, source.ExcludeKeys)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %v", source.MetaName, err)
+		}
+		sources = append(sources, sourceRef{name: source.MetaName, filter: filter})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("either metaName or sources must be set")
+	}
+	return sources, nil
+}
+
+// getSourceNames returns the names of all source Resources of the CopyResource
+func getSourceNames(copyResource *resourcebaloisechv1alpha1.CopyResource) []string {
+	var names []string
+	if copyResource.Spec.MetaName != "" {
+		names = append(names, copyResource.Spec.MetaName)
+	}
+	for _, source := range copyResource.Spec.Sources {
+		names = append(names, source.MetaName)
+	}
+	return names
+}
+
+func getMergeStrategy(copyResource *resourcebaloisechv1alpha1.CopyResource) resourcebaloisechv1alpha1.MergeStrategy {
+	if copyResource.Spec.MergeStrategy == "" {
+		return resourcebaloisechv1alpha1.MergeStrategyFailOnCollision
+	}
+	return copyResource.Spec.MergeStrategy
+}
+
+// mergeSources merges the filtered data of all sources into a copy of the first source.
+// The ResourceVersion of the result joins the ResourceVersions of all sources, so it changes whenever any source changes.
+func mergeSources(sources []*unstructured.Unstructured, filters []*keyFilter, strategy resourcebaloisechv1alpha1.MergeStrategy) (*unstructured.Unstructured, error) {
+	merged := sources[0].DeepCopy()
+	filters[0].apply(merged)
+	if len(sources) == 1 {
+		return merged, nil
+	}
+
+	resourceVersions := []string{merged.GetResourceVersion()}
+	for i, source := range sources[1:] {
+		source = source.DeepCopy()
+		filters[i+1].apply(source)
+		resourceVersions = append(resourceVersions, source.GetResourceVersion())
+
+		for _, field := range dataFields {
+			data, ok := source.Object[field].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			mergedData, ok := merged.Object[field].(map[string]interface{})
+			if !ok {
+				mergedData = map[string]interface{}{}
+				merged.Object[field] = mergedData
+			}
+			// Sorted keys keep the reported collision stable between reconciles
+			keys := make([]string, 0, len(data))
+			for key := range data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				value := data[key]
+				existing, exists := mergedData[key]
+				if !exists {
+					mergedData[key] = value
+					continue
+				}
+				switch strategy {
+				case resourcebaloisechv1alpha1.MergeStrategyLastWins:
+					mergedData[key] = value
+				case resourcebaloisechv1alpha1.MergeStrategyMerge:
+					mergedValue, err := mergeValues(key, existing, value, isEncoded(merged, field))
+					if err != nil {
+						return nil, fmt.Errorf("failed to merge key %s of source %s: %v", key, source.GetName(), err)
+					}
+					mergedData[key] = mergedValue
+				default:
+					return nil, fmt.Errorf("key %s of source %s collides with a previous source", key, source.GetName())
+				}
+			}
+		}
+	}
+	merged.SetResourceVersion(strings.Join(resourceVersions, ","))
+	return merged, nil
+}
+
+// isEncoded returns true if the values of the data field of the object are base64 encoded
+func isEncoded(object *unstructured.Unstructured, field string) bool {
+	return field == "binaryData" || (field == "data" && object.GetKind() == "Secret")
+}
+
+// mergeValues merges the auths of docker configs and the certificates of PEM bundles, all other values are replaced
+func mergeValues(key string, existing interface{}, value interface{}, encoded bool) (interface{}, error) {
+	existingText, _ := existing.(string)
+	text, _ := value.(string)
+	if encoded {
+		existingDecoded, err := base64.StdEncoding.DecodeString(existingText)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, err
+		}
+		existingText, text = string(existingDecoded), string(decoded)
+	}
+
+	var merged string
+	var err error
+	switch {
+	case key == ".dockerconfigjson":
+		merged, err = mergeDockerConfig(existingText, text, "auths")
+	case key == ".dockercfg":
+		merged, err = mergeDockerConfig(existingText, text, "")
+	case isPEM(existingText) && isPEM(text):
+		merged = mergePEM(existingText, text)
+	default:
+		merged = text
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded {
+		return base64.StdEncoding.EncodeToString([]byte(merged)), nil
+	}
+	return merged, nil
+}
+
+// mergeDockerConfig merges the registries of two docker configs, which are found in field or at the top level if field is empty.
+// Registries of the second config replace registries of the first config.
+func mergeDockerConfig(existing string, value string, field string) (string, error) {
+	existingConfig, config := map[string]interface{}{}, map[string]interface{}{}
+	if err := json.Unmarshal([]byte(existing), &existingConfig); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return "", err
+	}
+
+	existingRegistries, registries := existingConfig, config
+	if field != "" {
+		existingRegistries, _ = existingConfig[field].(map[string]interface{})
+		registries, _ = config[field].(map[string]interface{})
+		if existingRegistries == nil {
+			existingRegistries = map[string]interface{}{}
+		}
+		existingConfig[field] = existingRegistries
+	}
+	for registry, auth := range registries {
+		existingRegistries[registry] = auth
+	}
+
+	merged, err := json.Marshal(existingConfig)
+	return string(merged), err
+}
+
+func isPEM(value string) bool {
+	block, _ := pem.Decode([]byte(value))
+	return block != nil
+}
+
+// mergePEM appends all PEM blocks of value which are not contained in existing
+func mergePEM(existing string, value string) string {
+	var merged bytes.Buffer
+	seen := map[string]bool{}
+	for _, bundle := range []string{existing, value} {
+		rest := []byte(bundle)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			encoded := pem.EncodeToMemory(block)
+			if !seen[string(encoded)] {
+				seen[string(encoded)] = true
+				merged.Write(encoded)
+			}
+		}
+	}
+	return merged.String()
+}
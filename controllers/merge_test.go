@@ -0,0 +1,280 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// newTestObject returns a Secret or ConfigMap with the given data fields
+func newTestObject(kind string, name string, resourceVersion string, fields map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	object.SetAPIVersion("v1")
+	object.SetKind(kind)
+	object.SetNamespace("source")
+	object.SetName(name)
+	object.SetResourceVersion(resourceVersion)
+	for field, data := range fields {
+		object.Object[field] = data
+	}
+	return object
+}
+
+func encode(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func pemBlock(content string) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(content)}))
+}
+
+func TestMergeSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		sources  []*unstructured.Unstructured
+		filters  []*keyFilter
+		strategy resourcebaloisechv1alpha1.MergeStrategy
+		want     map[string]interface{}
+		wantErr  string
+	}{
+		{
+			name: "single source is copied",
+			sources: []*unstructured.Unstructured{
+				newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "1"}}),
+			},
+			want: map[string]interface{}{"x": "1"},
+		},
+		{
+			name: "distinct keys are combined",
+			sources: []*unstructured.Unstructured{
+				newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "1"}}),
+				newTestObject("ConfigMap", "b", "2", map[string]interface{}{"data": map[string]interface{}{"y": "2"}}),
+			},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyFailOnCollision,
+			want:     map[string]interface{}{"x": "1", "y": "2"},
+		},
+		{
+			name: "collision fails on the first colliding key in sorted order",
+			sources: []*unstructured.Unstructured{
+				newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "1", "y": "1"}}),
+				newTestObject("ConfigMap", "b", "2", map[string]interface{}{"data": map[string]interface{}{"y": "2", "x": "2"}}),
+			},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyFailOnCollision,
+			wantErr:  "key x of source b collides with a previous source",
+		},
+		{
+			name: "last source wins",
+			sources: []*unstructured.Unstructured{
+				newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "1"}}),
+				newTestObject("ConfigMap", "b", "2", map[string]interface{}{"data": map[string]interface{}{"x": "2"}}),
+				newTestObject("ConfigMap", "c", "3", map[string]interface{}{"data": map[string]interface{}{"x": "3"}}),
+			},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyLastWins,
+			want:     map[string]interface{}{"x": "3"},
+		},
+		{
+			name: "filtered keys don't collide",
+			sources: []*unstructured.Unstructured{
+				newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "1"}}),
+				newTestObject("ConfigMap", "b", "2", map[string]interface{}{"data": map[string]interface{}{"x": "2", "y": "2"}}),
+			},
+			filters:  []*keyFilter{{}, mustKeyFilter(t, nil, []string{"x"})},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyFailOnCollision,
+			want:     map[string]interface{}{"x": "1", "y": "2"},
+		},
+		{
+			name: "PEM bundles of ConfigMaps are merged",
+			sources: []*unstructured.Unstructured{
+				newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"ca.crt": pemBlock("a")}}),
+				newTestObject("ConfigMap", "b", "2", map[string]interface{}{"data": map[string]interface{}{"ca.crt": pemBlock("b")}}),
+			},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyMerge,
+			want:     map[string]interface{}{"ca.crt": pemBlock("a") + pemBlock("b")},
+		},
+		{
+			name: "PEM bundles of Secrets are merged base64 encoded",
+			sources: []*unstructured.Unstructured{
+				newTestObject("Secret", "a", "1", map[string]interface{}{"data": map[string]interface{}{"ca.crt": encode(pemBlock("a"))}}),
+				newTestObject("Secret", "b", "2", map[string]interface{}{"data": map[string]interface{}{"ca.crt": encode(pemBlock("b"))}}),
+			},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyMerge,
+			want:     map[string]interface{}{"ca.crt": encode(pemBlock("a") + pemBlock("b"))},
+		},
+		{
+			name: "invalid base64 fails to merge",
+			sources: []*unstructured.Unstructured{
+				newTestObject("Secret", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "!"}}),
+				newTestObject("Secret", "b", "2", map[string]interface{}{"data": map[string]interface{}{"x": encode("b")}}),
+			},
+			strategy: resourcebaloisechv1alpha1.MergeStrategyMerge,
+			wantErr:  "failed to merge key x of source b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filters := test.filters
+			if filters == nil {
+				for range test.sources {
+					filters = append(filters, &keyFilter{})
+				}
+			}
+			merged, err := mergeSources(test.sources, filters, test.strategy)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := merged.Object["data"]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected data %v, got %v", test.want, got)
+			}
+			var resourceVersions []string
+			for _, source := range test.sources {
+				resourceVersions = append(resourceVersions, source.GetResourceVersion())
+			}
+			if got, want := merged.GetResourceVersion(), strings.Join(resourceVersions, ","); got != want {
+				t.Errorf("expected resourceVersion %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestMergeSourcesKeepsSources(t *testing.T) {
+	first := newTestObject("ConfigMap", "a", "1", map[string]interface{}{"data": map[string]interface{}{"x": "1"}})
+	second := newTestObject("ConfigMap", "b", "2", map[string]interface{}{"data": map[string]interface{}{"x": "2"}})
+	_, err := mergeSources([]*unstructured.Unstructured{first, second}, []*keyFilter{{}, {}}, resourcebaloisechv1alpha1.MergeStrategyLastWins)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := first.Object["data"].(map[string]interface{})["x"]; got != "1" {
+		t.Errorf("expected the first source to be unchanged, got %v", got)
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		existing string
+		value    string
+		encoded  bool
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "plain values are replaced",
+			key:      "x",
+			existing: "a",
+			value:    "b",
+			want:     "b",
+		},
+		{
+			name:     "encoded plain values are replaced",
+			key:      "x",
+			existing: encode("a"),
+			value:    encode("b"),
+			encoded:  true,
+			want:     encode("b"),
+		},
+		{
+			name:     "docker config auths are merged",
+			key:      ".dockerconfigjson",
+			existing: `{"auths":{"a.io":{"auth":"a"},"c.io":{"auth":"old"}}}`,
+			value:    `{"auths":{"b.io":{"auth":"b"},"c.io":{"auth":"new"}}}`,
+			want:     `{"auths":{"a.io":{"auth":"a"},"b.io":{"auth":"b"},"c.io":{"auth":"new"}}}`,
+		},
+		{
+			name:     "docker config auths are added to a config without auths",
+			key:      ".dockerconfigjson",
+			existing: `{}`,
+			value:    `{"auths":{"b.io":{"auth":"b"}}}`,
+			want:     `{"auths":{"b.io":{"auth":"b"}}}`,
+		},
+		{
+			name:     "legacy docker configs are merged at the top level",
+			key:      ".dockercfg",
+			existing: `{"a.io":{"auth":"a"}}`,
+			value:    `{"b.io":{"auth":"b"}}`,
+			want:     `{"a.io":{"auth":"a"},"b.io":{"auth":"b"}}`,
+		},
+		{
+			name:     "encoded docker configs are merged",
+			key:      ".dockerconfigjson",
+			existing: encode(`{"auths":{"a.io":{"auth":"a"}}}`),
+			value:    encode(`{"auths":{"b.io":{"auth":"b"}}}`),
+			encoded:  true,
+			want:     encode(`{"auths":{"a.io":{"auth":"a"},"b.io":{"auth":"b"}}}`),
+		},
+		{
+			name:     "invalid docker configs fail",
+			key:      ".dockerconfigjson",
+			existing: `{`,
+			value:    `{}`,
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate PEM blocks are dropped",
+			key:      "ca.crt",
+			existing: pemBlock("a") + pemBlock("b"),
+			value:    pemBlock("b") + pemBlock("c"),
+			want:     pemBlock("a") + pemBlock("b") + pemBlock("c"),
+		},
+		{
+			name:     "PEM is not merged with other values",
+			key:      "ca.crt",
+			existing: pemBlock("a"),
+			value:    "plain",
+			want:     "plain",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := mergeValues(test.key, test.existing, test.value, test.encoded)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func mustKeyFilter(t *testing.T, includeKeys []string, excludeKeys []string) *keyFilter {
+	filter, err := newKeyFilter(includeKeys, excludeKeys)
+	if err != nil {
+		t.Fatalf("invalid key filter: %v", err)
+	}
+	return filter
+}
@@ -0,0 +1,164 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// The results of a copy to a target Resource
+const (
+	copyResultCreated = "created"
+	copyResultUpdated = "updated"
+	copyResultFailed  = "failed"
+)
+
+var (
+	copiesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "os3_copier_copies_total",
+		Help: "Number of copies to target resources by kind, target namespace and result (created, updated, failed).",
+	}, []string{"kind", "namespace", "result"})
+
+	propagationLagSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "os3_copier_propagation_lag_seconds",
+		Help:    "Time between the last change of a source resource and the update of its target resources.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"kind"})
+
+	copyResourcesDesc = prometheus.NewDesc(
+		"os3_copier_copyresources",
+		"Number of CopyResources by condition and condition status.",
+		[]string{"condition", "status"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(copiesTotal, propagationLagSeconds)
+}
+
+// recordCopy counts a copy to a target Resource
+func recordCopy(target *unstructured.Unstructured, result string) {
+	copiesTotal.WithLabelValues(target.GetKind(), target.GetNamespace(), result).Inc()
+}
+
+// sourceChangeRetention limits how long observed source changes are kept, it matches the largest lag bucket
+const sourceChangeRetention = 10 * time.Minute
+
+// sourceChange is the first observation of a resourceVersion of a source Resource
+type sourceChange struct {
+	resourceVersion string
+	observed        time.Time
+}
+
+// sourceChanges holds the last observed change per source Resource by its source index value.
+// managedFields are not available on OpenShift 3.x and change with every writer, so the lag is measured
+// from the time the watch delivered the new resourceVersion.
+var sourceChanges = struct {
+	sync.Mutex
+	changes map[string]sourceChange
+}{changes: map[string]sourceChange{}}
+
+// observeSourceChange records the time a resourceVersion of a source Resource was first seen
+func observeSourceChange(kind string, namespace string, name string, resourceVersion string) {
+	sourceChanges.Lock()
+	defer sourceChanges.Unlock()
+
+	key := sourceIndexValue(kind, namespace, name)
+	if change, ok := sourceChanges.changes[key]; ok && change.resourceVersion == resourceVersion {
+		return
+	}
+	now := time.Now()
+	for k, change := range sourceChanges.changes {
+		if now.Sub(change.observed) > sourceChangeRetention {
+			delete(sourceChanges.changes, k)
+		}
+	}
+	sourceChanges.changes[key] = sourceChange{resourceVersion: resourceVersion, observed: now}
+}
+
+// recordPropagationLag observes the time since the change to the current resourceVersion of the source Resource
+// was seen, nothing is observed if the change was not seen by the watch, e.g. for merged sources
+func recordPropagationLag(source *unstructured.Unstructured) {
+	sourceChanges.Lock()
+	change, ok := sourceChanges.changes[sourceIndexValue(source.GetKind(), source.GetNamespace(), source.GetName())]
+	sourceChanges.Unlock()
+	if !ok || change.resourceVersion != source.GetResourceVersion() {
+		return
+	}
+	propagationLagSeconds.WithLabelValues(source.GetKind()).Observe(time.Since(change.observed).Seconds())
+}
+
+// copyResourceCollector counts the CopyResources per condition whenever the metrics are scraped
+type copyResourceCollector struct {
+	client client.Client
+	log    logr.Logger
+}
+
+func (c *copyResourceCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- copyResourcesDesc
+}
+
+func (c *copyResourceCollector) Collect(metrics chan<- prometheus.Metric) {
+	copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+	err := c.client.List(context.TODO(), copyResources)
+	if err != nil {
+		c.log.Error(err, "Failed to list CopyResources.")
+		return
+	}
+
+	counts := map[[2]string]int{}
+	for _, conditionType := range []string{
+		resourcebaloisechv1alpha1.ConditionReady,
+		resourcebaloisechv1alpha1.ConditionSourceFound,
+		resourcebaloisechv1alpha1.ConditionTargetSynced,
+		resourcebaloisechv1alpha1.ConditionConflict,
+		resourcebaloisechv1alpha1.ConditionKeysMapped,
+		resourcebaloisechv1alpha1.ConditionPolicyDenied,
+		resourcebaloisechv1alpha1.ConditionSourceOptedIn,
+	} {
+		for _, conditionStatus := range []metav1.ConditionStatus{metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionUnknown} {
+			counts[[2]string{conditionType, string(conditionStatus)}] = 0
+		}
+	}
+	for _, copyResource := range copyResources.Items {
+		for _, condition := range copyResource.Status.Conditions {
+			counts[[2]string{condition.Type, string(condition.Status)}]++
+		}
+	}
+	for labels, count := range counts {
+		metrics <- prometheus.MustNewConstMetric(copyResourcesDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1])
+	}
+}
+
+// registerCopyResourceCollector registers the CopyResource gauge in the controller-runtime metrics registry
+func registerCopyResourceCollector(c client.Client, log logr.Logger) error {
+	err := metrics.Registry.Register(&copyResourceCollector{client: c, log: log})
+	if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// allowedTargetsAnnotation opts a source Resource in to be copied to the listed target namespaces,
+// given as comma separated exact names or globs
+const allowedTargetsAnnotation = "copier.baloise.ch/allowed-targets"
+
+// getAllowedTargets returns the target namespace patterns the source Resource opted in to,
+// ok is false if the source Resource has not opted in at all
+func getAllowedTargets(sourceResource *unstructured.Unstructured) (patterns []string, ok bool) {
+	for _, pattern := range strings.Split(sourceResource.GetAnnotations()[allowedTargetsAnnotation], ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, len(patterns) > 0
+}
+
+// checkSourceOptIn returns the target namespaces which any of the source Resources has not opted in to,
+// together with a message per source Resource explaining why
+func checkSourceOptIn(sourceResources []*unstructured.Unstructured, targetNamespaces []string) (deniedNamespaces []string, messages []string) {
+	for _, sourceResource := range sourceResources {
+		patterns, ok := getAllowedTargets(sourceResource)
+		if !ok {
+			messages = append(messages, fmt.Sprintf("%s %s/%s has no %s annotation",
+				sourceResource.GetKind(), sourceResource.GetNamespace(), sourceResource.GetName(), allowedTargetsAnnotation))
+		}
+		var denied []string
+		for _, targetNamespace := range targetNamespaces {
+			if !ok || !matchesAnyPattern(patterns, targetNamespace) {
+				denied = append(denied, targetNamespace)
+				if !containsString(deniedNamespaces, targetNamespace) {
+					deniedNamespaces = append(deniedNamespaces, targetNamespace)
+				}
+			}
+		}
+		if ok && len(denied) > 0 {
+			messages = append(messages, fmt.Sprintf("%s %s/%s does not allow %s",
+				sourceResource.GetKind(), sourceResource.GetNamespace(), sourceResource.GetName(), strings.Join(denied, ", ")))
+		}
+	}
+	return deniedNamespaces, messages
+}
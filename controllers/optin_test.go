@@ -0,0 +1,95 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCheckSourceOptIn(t *testing.T) {
+	tests := []struct {
+		name             string
+		annotations      []map[string]string
+		targetNamespaces []string
+		wantDenied       []string
+		wantMessages     []string
+	}{
+		{
+			name:             "all target namespaces allowed",
+			annotations:      []map[string]string{{allowedTargetsAnnotation: "ns-a, team-*"}},
+			targetNamespaces: []string{"ns-a", "team-x"},
+		},
+		{
+			name:             "target namespaces not allowed",
+			annotations:      []map[string]string{{allowedTargetsAnnotation: "ns-a,team-*"}},
+			targetNamespaces: []string{"ns-a", "ns-b", "other"},
+			wantDenied:       []string{"ns-b", "other"},
+			wantMessages:     []string{"Secret source/s0 does not allow ns-b, other"},
+		},
+		{
+			name:             "missing annotation denies all target namespaces",
+			annotations:      []map[string]string{nil},
+			targetNamespaces: []string{"ns-a"},
+			wantDenied:       []string{"ns-a"},
+			wantMessages:     []string{"Secret source/s0 has no copier.baloise.ch/allowed-targets annotation"},
+		},
+		{
+			name:             "empty annotation denies all target namespaces",
+			annotations:      []map[string]string{{allowedTargetsAnnotation: " , "}},
+			targetNamespaces: []string{"ns-a"},
+			wantDenied:       []string{"ns-a"},
+			wantMessages:     []string{"Secret source/s0 has no copier.baloise.ch/allowed-targets annotation"},
+		},
+		{
+			name:             "missing annotation is reported without target namespaces",
+			annotations:      []map[string]string{nil},
+			targetNamespaces: nil,
+			wantMessages:     []string{"Secret source/s0 has no copier.baloise.ch/allowed-targets annotation"},
+		},
+		{
+			name: "every source must allow the target namespace",
+			annotations: []map[string]string{
+				{allowedTargetsAnnotation: "ns-a,ns-b"},
+				{allowedTargetsAnnotation: "ns-b"},
+			},
+			targetNamespaces: []string{"ns-a", "ns-b"},
+			wantDenied:       []string{"ns-a"},
+			wantMessages:     []string{"Secret source/s1 does not allow ns-a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sources []*unstructured.Unstructured
+			for i, annotations := range test.annotations {
+				source := newTestObject("Secret", fmt.Sprintf("s%d", i), "1", nil)
+				source.SetAnnotations(annotations)
+				sources = append(sources, source)
+			}
+			denied, messages := checkSourceOptIn(sources, test.targetNamespaces)
+			if !reflect.DeepEqual(denied, test.wantDenied) {
+				t.Errorf("expected denied namespaces %v, got %v", test.wantDenied, denied)
+			}
+			if !reflect.DeepEqual(messages, test.wantMessages) {
+				t.Errorf("expected messages %v, got %v", test.wantMessages, messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// Target Resources live in other namespaces than their CopyResource, which rules out owner references.
+// Instead they are tracked by the following labels and annotations.
+const (
+	// SourceNamespaceLabel is set on every target Resource and holds the namespace of the owning CopyResource
+	SourceNamespaceLabel = "copier.baloise.ch/source-namespace"
+	// CopyResourceUIDLabel is set on every target Resource and holds the UID of the owning CopyResource
+	CopyResourceUIDLabel = "copier.baloise.ch/copy-resource-uid"
+	// CopyResourceAnnotation is set on every target Resource and references the owning CopyResource as namespace/name
+	CopyResourceAnnotation = "copier.baloise.ch/copy-resource"
+	// DeletionPolicyAnnotation is set on every target Resource and holds the DeletionPolicy of the owning CopyResource
+	DeletionPolicyAnnotation = "copier.baloise.ch/deletion-policy"
+)
+
+// setOwnership marks the target Resource as owned by the CopyResource
+func setOwnership(target metav1.Object, copyResource *resourcebaloisechv1alpha1.CopyResource) {
+	target.SetOwnerReferences(nil)
+	setLabel(target, SourceNamespaceLabel, copyResource.Namespace)
+	setLabel(target, CopyResourceUIDLabel, string(copyResource.UID))
+	setAnnotation(target, CopyResourceAnnotation, copyResource.Namespace+"/"+copyResource.Name)
+	setAnnotation(target, DeletionPolicyAnnotation, string(getDeletionPolicy(copyResource)))
+}
+
+// isOwnedBy returns true if the target Resource carries the complete ownership of the CopyResource
+func isOwnedBy(target metav1.Object, copyResource *resourcebaloisechv1alpha1.CopyResource) bool {
+	return len(target.GetOwnerReferences()) == 0 &&
+		target.GetLabels()[SourceNamespaceLabel] == copyResource.Namespace &&
+		target.GetLabels()[CopyResourceUIDLabel] == string(copyResource.UID) &&
+		target.GetAnnotations()[CopyResourceAnnotation] == copyResource.Namespace+"/"+copyResource.Name &&
+		target.GetAnnotations()[DeletionPolicyAnnotation] == string(getDeletionPolicy(copyResource))
+}
+
+// isManagedBy returns true if the target Resource was written by the CopyResource,
+// including targets of a CopyResource recreated with the same name and owner references of previous versions
+func isManagedBy(target metav1.Object, copyResource *resourcebaloisechv1alpha1.CopyResource) bool {
+	if target.GetLabels()[CopyResourceUIDLabel] == string(copyResource.UID) ||
+		target.GetAnnotations()[CopyResourceAnnotation] == copyResource.Namespace+"/"+copyResource.Name {
+		return true
+	}
+	for _, ownerReference := range target.GetOwnerReferences() {
+		if ownerReference.UID == copyResource.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// isManaged returns true if the target Resource was written by any CopyResource
+func isManaged(target metav1.Object) bool {
+	_, hasLabel := target.GetLabels()[CopyResourceUIDLabel]
+	_, hasAnnotation := target.GetAnnotations()[CopyResourceAnnotation]
+	return hasLabel || hasAnnotation
+}
+
+// getOwner returns the namespace and name of the CopyResource owning the target Resource
+func getOwner(target metav1.Object) (types.NamespacedName, bool) {
+	parts := strings.SplitN(target.GetAnnotations()[CopyResourceAnnotation], "/", 2)
+	if len(parts) != 2 {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true
+}
+
+// listOwnedTargets lists all target Resources of gvk in all namespaces matching the ownership labels
+func listOwnedTargets(c client.Client, gvk schema.GroupVersionKind, labelSelector client.ListOption) ([]unstructured.Unstructured, error) {
+	// Use an unstructured type to avoid cache reader
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	err := c.List(context.TODO(), list, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// releaseTarget deletes the target Resource if its DeletionPolicy is Delete, otherwise the ownership is removed
+func releaseTarget(c client.Client, target *unstructured.Unstructured, log logr.Logger) error {
+	if resourcebaloisechv1alpha1.DeletionPolicy(target.GetAnnotations()[DeletionPolicyAnnotation]) == resourcebaloisechv1alpha1.DeletionPolicyDelete {
+		err := c.Delete(context.TODO(), target)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		log.Info("Successfully deleted.", "name", target.GetName(), "namespace ", target.GetNamespace())
+		return nil
+	}
+
+	targetLabels := target.GetLabels()
+	delete(targetLabels, SourceNamespaceLabel)
+	delete(targetLabels, CopyResourceUIDLabel)
+	target.SetLabels(targetLabels)
+	targetAnnotations := target.GetAnnotations()
+	delete(targetAnnotations, CopyResourceAnnotation)
+	delete(targetAnnotations, DeletionPolicyAnnotation)
+	target.SetAnnotations(targetAnnotations)
+	err := c.Update(context.TODO(), target)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.Info("Successfully orphaned.", "name", target.GetName(), "namespace ", target.GetNamespace())
+	return nil
+}
+
+// releaseStaleTargets releases all target Resources owned by the CopyResource which are not in targetNamespaces anymore
+func (r *CopyResourceReconciler) releaseStaleTargets(copyResource *resourcebaloisechv1alpha1.CopyResource, gvk schema.GroupVersionKind, targetNamespaces []string, log logr.Logger) error {
+	targets, err := listOwnedTargets(r.Client, gvk, client.MatchingLabels{CopyResourceUIDLabel: string(copyResource.UID)})
+	if err != nil {
+		return err
+	}
+	for i := range targets {
+		target := &targets[i]
+		if containsString(targetNamespaces, target.GetNamespace()) && target.GetName() == getTargetName(copyResource) {
+			continue
+		}
+		err = releaseTarget(r.Client, target, log)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OrphanCollector periodically releases target Resources whose owning CopyResource or annotated source Resource
+// does not exist anymore
+type OrphanCollector struct {
+	client.Client
+	// APIReader is used to look up CopyResources outside of the cached namespace
+	APIReader client.Reader
+	Log       logr.Logger
+	Interval  time.Duration
+}
+
+// Start runs the OrphanCollector until stop is closed
+func (c *OrphanCollector) Start(stop <-chan struct{}) error {
+	wait.Until(c.collect, c.Interval, stop)
+	return nil
+}
+
+func (c *OrphanCollector) collect() {
+	for _, gvk := range c.getGroupVersionKinds() {
+		targets, err := listOwnedTargets(c.Client, gvk, client.HasLabels{CopyResourceUIDLabel})
+		if err != nil {
+			c.Log.Error(err, "Failed to list target resources.", "kind", gvk.String())
+			continue
+		}
+		for i := range targets {
+			target := &targets[i]
+			if c.isOwnerPresent(target, target.GetLabels()[CopyResourceUIDLabel]) {
+				continue
+			}
+			log := c.Log.WithValues("CopyResource", target.GetAnnotations()[CopyResourceAnnotation])
+			err = releaseTarget(c.Client, target, log)
+			if err != nil {
+				log.Error(err, "Failed to release orphaned target resource.", "name", target.GetName(), "namespace ", target.GetNamespace())
+			}
+		}
+	}
+}
+
+// getGroupVersionKinds returns the target kinds of all CopyResources, Secrets and ConfigMaps are always included
+func (c *OrphanCollector) getGroupVersionKinds() []schema.GroupVersionKind {
+	gvks := []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Secret"},
+		{Version: "v1", Kind: "ConfigMap"},
+	}
+	copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+	err := c.APIReader.List(context.TODO(), copyResources)
+	if err != nil {
+		c.Log.Error(err, "Failed to list CopyResources.")
+		return gvks
+	}
+	for i := range copyResources.Items {
+		gvk, err := GetTargetGroupVersionKind(&copyResources.Items[i])
+		if err != nil || containsGroupVersionKind(gvks, gvk) {
+			continue
+		}
+		gvks = append(gvks, gvk)
+	}
+	return gvks
+}
+
+func containsGroupVersionKind(gvks []schema.GroupVersionKind, gvk schema.GroupVersionKind) bool {
+	for _, item := range gvks {
+		if item == gvk {
+			return true
+		}
+	}
+	return false
+}
+
+// isOwnerPresent returns false only if the owning CopyResource or annotated source Resource is known to be gone
+func (c *OrphanCollector) isOwnerPresent(target *unstructured.Unstructured, uid string) bool {
+	owner, ok := getOwner(target)
+	if !ok {
+		return false
+	}
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{}
+	err := c.APIReader.Get(context.TODO(), owner, copyResource)
+	if err != nil && !errors.IsNotFound(err) {
+		c.Log.Error(err, "Failed to get CopyResource.", "namespacedName", owner)
+		return true
+	}
+	if err == nil && string(copyResource.UID) == uid {
+		return true
+	}
+	return c.isAnnotatedSourcePresent(target.GroupVersionKind(), owner, uid)
+}
+
+// isAnnotatedSourcePresent returns false only if the annotated source Resource owning a target is known to be gone
+// or has lost its copy annotations. Annotated source Resources are always copied to targets of their own kind.
+func (c *OrphanCollector) isAnnotatedSourcePresent(gvk schema.GroupVersionKind, owner types.NamespacedName, uid string) bool {
+	if _, ok := annotatedKinds[gvk.Kind]; !ok || gvk.Group != "" {
+		return false
+	}
+	sourceResource := &unstructured.Unstructured{}
+	sourceResource.SetGroupVersionKind(gvk)
+	err := c.APIReader.Get(context.TODO(), owner, sourceResource)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false
+		}
+		c.Log.Error(err, "Failed to get annotated source resource.", "kind", gvk.Kind, "namespacedName", owner)
+		return true
+	}
+	return string(sourceResource.GetUID()) == uid && isAnnotatedSource(sourceResource)
+}
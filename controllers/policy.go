@@ -0,0 +1,182 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// PolicyDenial describes why the CopyPolicies forbid copying into a target namespace
+type PolicyDenial struct {
+	Namespace string
+	Reason    string
+}
+
+func (d PolicyDenial) String() string {
+	return d.Namespace + ": " + d.Reason
+}
+
+// ListCopyPolicies returns all CopyPolicies ordered by name
+func ListCopyPolicies(ctx context.Context, reader client.Reader) ([]resourcebaloisechv1alpha1.CopyPolicy, error) {
+	copyPolicies := &resourcebaloisechv1alpha1.CopyPolicyList{}
+	err := reader.List(ctx, copyPolicies)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(copyPolicies.Items, func(i, j int) bool {
+		return copyPolicies.Items[i].Name < copyPolicies.Items[j].Name
+	})
+	return copyPolicies.Items, nil
+}
+
+// EvaluatePolicies returns a PolicyDenial for every target namespace the CopyPolicies forbid the CopyResource to copy to
+func EvaluatePolicies(copyPolicies []resourcebaloisechv1alpha1.CopyPolicy, copyResource *resourcebaloisechv1alpha1.CopyResource, targetNamespaces []string) []PolicyDenial {
+	return evaluateCopyResource(copyPolicies, copyResource, targetNamespaces, false)
+}
+
+// evaluateCopyResource returns a PolicyDenial for every target namespace the CopyPolicies forbid the CopyResource to copy to.
+// Copies by annotation need to match an Allow rule, even if there are no CopyPolicies at all.
+func evaluateCopyResource(copyPolicies []resourcebaloisechv1alpha1.CopyPolicy, copyResource *resourcebaloisechv1alpha1.CopyResource, targetNamespaces []string, annotation bool) []PolicyDenial {
+	if len(copyPolicies) == 0 && !annotation {
+		return nil
+	}
+	kinds := []string{copyResource.Spec.Kind}
+	if copyResource.Spec.TargetKind != "" && copyResource.Spec.TargetKind != copyResource.Spec.Kind {
+		kinds = append(kinds, copyResource.Spec.TargetKind)
+	}
+
+	var denials []PolicyDenial
+	for _, targetNamespace := range targetNamespaces {
+		if reason := evaluateTarget(copyPolicies, copyResource, kinds, targetNamespace, annotation); reason != "" {
+			denials = append(denials, PolicyDenial{Namespace: targetNamespace, Reason: reason})
+		}
+	}
+	return denials
+}
+
+// evaluateTarget returns why the CopyPolicies forbid copying any of the sources into the target namespace
+func evaluateTarget(copyPolicies []resourcebaloisechv1alpha1.CopyPolicy, copyResource *resourcebaloisechv1alpha1.CopyResource, kinds []string, targetNamespace string, annotation bool) string {
+	for _, kind := range kinds {
+		for _, name := range getSourceNames(copyResource) {
+			reason := evaluatePolicies(copyPolicies, copyRequest{
+				sourceNamespace: getSourceNamespace(copyResource),
+				targetNamespace: targetNamespace,
+				kind:            kind,
+				name:            name,
+				annotation:      annotation,
+			})
+			if reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+// copyRequest describes the copy of one source Resource into one target namespace
+type copyRequest struct {
+	sourceNamespace string
+	targetNamespace string
+	kind            string
+	name            string
+	// annotation marks copies requested by the copy-to annotations of the source
+	annotation bool
+}
+
+// evaluatePolicies returns why the CopyPolicies forbid the copyRequest or an empty string if it is permitted.
+// Copies by annotation need to match an Allow rule, other copies only if any CopyPolicy has Allow rules applying to them.
+func evaluatePolicies(copyPolicies []resourcebaloisechv1alpha1.CopyPolicy, request copyRequest) string {
+	hasAllowRules := request.annotation
+	allowed := false
+	for _, copyPolicy := range copyPolicies {
+		for _, rule := range copyPolicy.Spec.Deny {
+			if ruleMatches(rule, request) {
+				return fmt.Sprintf("%s %s/%s is denied by CopyPolicy %s", request.kind, request.sourceNamespace, request.name, copyPolicy.Name)
+			}
+		}
+		for _, rule := range copyPolicy.Spec.Allow {
+			if rule.Annotations && !request.annotation {
+				continue
+			}
+			hasAllowRules = true
+			if ruleMatches(rule, request) {
+				allowed = true
+			}
+		}
+	}
+	if hasAllowRules && !allowed {
+		return fmt.Sprintf("%s %s/%s is not allowed by any CopyPolicy", request.kind, request.sourceNamespace, request.name)
+	}
+	return ""
+}
+
+// ruleMatches returns true if all fields of the rule match the copyRequest, rules for Annotations only match copies by annotation
+func ruleMatches(rule resourcebaloisechv1alpha1.CopyPolicyRule, request copyRequest) bool {
+	return (!rule.Annotations || request.annotation) &&
+		matchesAnyPattern(rule.SourceNamespaces, request.sourceNamespace) &&
+		matchesAnyPattern(rule.TargetNamespaces, request.targetNamespace) &&
+		matchesAnyPattern(rule.Kinds, request.kind) &&
+		matchesAnyPattern(rule.Names, request.name)
+}
+
+// matchesAnyPattern returns true if patterns is empty or any of the exact names or globs matches value
+func matchesAnyPattern(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchesPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPattern returns true if the exact name or glob matches value
+func matchesPattern(pattern string, value string) bool {
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// mapCopyPolicyToCopyResources enqueues all CopyResources, as any of them may be affected by the changed CopyPolicy
+func (r *CopyResourceReconciler) mapCopyPolicyToCopyResources(copyPolicy handler.MapObject) []reconcile.Request {
+	copyResources := &resourcebaloisechv1alpha1.CopyResourceList{}
+	err := r.List(context.TODO(), copyResources)
+	if err != nil {
+		r.Log.Error(err, "Failed to list CopyResources.", "copyPolicy", copyPolicy.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, copyResource := range copyResources.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: copyResource.Namespace,
+			Name:      copyResource.Name,
+		}})
+	}
+	return requests
+}
@@ -0,0 +1,203 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+func newTestCopyPolicy(name string, allow []resourcebaloisechv1alpha1.CopyPolicyRule, deny []resourcebaloisechv1alpha1.CopyPolicyRule) resourcebaloisechv1alpha1.CopyPolicy {
+	return resourcebaloisechv1alpha1.CopyPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       resourcebaloisechv1alpha1.CopyPolicySpec{Allow: allow, Deny: deny},
+	}
+}
+
+func TestEvaluatePolicies(t *testing.T) {
+	request := copyRequest{sourceNamespace: "platform", targetNamespace: "team-a", kind: "Secret", name: "registry"}
+	tests := []struct {
+		name       string
+		policies   []resourcebaloisechv1alpha1.CopyPolicy
+		annotation bool
+		wantReason string
+	}{
+		{
+			name: "no policies permit everything",
+		},
+		{
+			name:       "no policies deny every copy by annotation",
+			annotation: true,
+			wantReason: "Secret platform/registry is not allowed by any CopyPolicy",
+		},
+		{
+			name: "matching deny rule",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("protect", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"team-*"}}}),
+			},
+			wantReason: "Secret platform/registry is denied by CopyPolicy protect",
+		},
+		{
+			name: "deny rule matches only if all fields match",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("protect", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"team-*"}, Kinds: []string{"ConfigMap"}}}),
+			},
+		},
+		{
+			name: "deny takes precedence over allow of the same policy",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("mixed", []resourcebaloisechv1alpha1.CopyPolicyRule{{}}, []resourcebaloisechv1alpha1.CopyPolicyRule{{Names: []string{"registry"}}}),
+			},
+			wantReason: "Secret platform/registry is denied by CopyPolicy mixed",
+		},
+		{
+			name: "deny takes precedence over allow of another policy",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("allow", []resourcebaloisechv1alpha1.CopyPolicyRule{{SourceNamespaces: []string{"platform"}}}, nil),
+				newTestCopyPolicy("deny", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{Kinds: []string{"Secret"}}}),
+			},
+			wantReason: "Secret platform/registry is denied by CopyPolicy deny",
+		},
+		{
+			name: "matching allow rule",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("allow", []resourcebaloisechv1alpha1.CopyPolicyRule{{SourceNamespaces: []string{"platform"}, TargetNamespaces: []string{"team-*"}}}, nil),
+			},
+		},
+		{
+			name: "any allow rule denies everything else",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("other", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"other"}}}, nil),
+			},
+			wantReason: "Secret platform/registry is not allowed by any CopyPolicy",
+		},
+		{
+			name: "allow rule of another policy permits",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("other", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"other"}}}, nil),
+				newTestCopyPolicy("registry", []resourcebaloisechv1alpha1.CopyPolicyRule{{Names: []string{"regis*"}}}, nil),
+			},
+		},
+		{
+			name: "deny rules alone don't require an allow",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("protect", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"kube-*"}}}),
+			},
+		},
+		{
+			name: "deny rules alone don't permit copies by annotation",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("protect", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"kube-*"}}}),
+			},
+			annotation: true,
+			wantReason: "Secret platform/registry is not allowed by any CopyPolicy",
+		},
+		{
+			name: "allow rules for annotations don't restrict CopyResources",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("annotations", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"other"}, Annotations: true}}, nil),
+			},
+		},
+		{
+			name: "allow rule for annotations permits copies by annotation",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("annotations", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"team-*"}, Annotations: true}}, nil),
+			},
+			annotation: true,
+		},
+		{
+			name: "allow rule for annotations denies other copies by annotation",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("annotations", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"other"}, Annotations: true}}, nil),
+			},
+			annotation: true,
+			wantReason: "Secret platform/registry is not allowed by any CopyPolicy",
+		},
+		{
+			name: "allow rule for annotations doesn't permit CopyResources",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("other", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"other"}}}, nil),
+				newTestCopyPolicy("annotations", []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"team-*"}, Annotations: true}}, nil),
+			},
+			wantReason: "Secret platform/registry is not allowed by any CopyPolicy",
+		},
+		{
+			name: "allow rule without annotations permits copies by annotation",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("registry", []resourcebaloisechv1alpha1.CopyPolicyRule{{Names: []string{"registry"}}}, nil),
+			},
+			annotation: true,
+		},
+		{
+			name: "deny rule for annotations doesn't deny CopyResources",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("annotations", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{Annotations: true}}),
+			},
+		},
+		{
+			name: "deny rule for annotations denies copies by annotation",
+			policies: []resourcebaloisechv1alpha1.CopyPolicy{
+				newTestCopyPolicy("annotations", []resourcebaloisechv1alpha1.CopyPolicyRule{{}}, []resourcebaloisechv1alpha1.CopyPolicyRule{{Annotations: true}}),
+			},
+			annotation: true,
+			wantReason: "Secret platform/registry is denied by CopyPolicy annotations",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := request
+			request.annotation = test.annotation
+			if got := evaluatePolicies(test.policies, request); got != test.wantReason {
+				t.Errorf("expected reason %q, got %q", test.wantReason, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateCopyResource(t *testing.T) {
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "copy"},
+		Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+			Kind:       "Secret",
+			TargetKind: "ConfigMap",
+			Sources:    []resourcebaloisechv1alpha1.Source{{MetaName: "a"}, {MetaName: "b"}},
+		},
+	}
+	policies := []resourcebaloisechv1alpha1.CopyPolicy{
+		newTestCopyPolicy("names", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"team-b"}, Names: []string{"b"}}}),
+		newTestCopyPolicy("kinds", nil, []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"team-c"}, Kinds: []string{"ConfigMap"}}}),
+	}
+
+	denials := EvaluatePolicies(policies, copyResource, []string{"team-a", "team-b", "team-c"})
+	want := []PolicyDenial{
+		{Namespace: "team-b", Reason: "Secret platform/b is denied by CopyPolicy names"},
+		{Namespace: "team-c", Reason: "ConfigMap platform/a is denied by CopyPolicy kinds"},
+	}
+	if !reflect.DeepEqual(denials, want) {
+		t.Errorf("expected denials %v, got %v", want, denials)
+	}
+
+	denials = evaluateCopyResource(nil, copyResource, []string{"team-a"}, true)
+	if len(denials) != 1 || !strings.Contains(denials[0].Reason, "not allowed by any CopyPolicy") {
+		t.Errorf("expected team-a to be denied without an allow rule, got %v", denials)
+	}
+}
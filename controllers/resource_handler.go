@@ -0,0 +1,236 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ResourceHandler implements the copy semantics of a kind.
+// Register a ResourceHandler in a ResourceHandlerRegistry to customize how a kind is copied.
+type ResourceHandler interface {
+	// NewObject returns an empty object of the given kind
+	NewObject(gvk schema.GroupVersionKind) *unstructured.Unstructured
+	// Clone returns a deep copy of the source object
+	Clone(source *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	// Sanitize removes all fields from the cloned object which must not be written to the target,
+	// stripFields are additional dot separated field paths requested by the CopyResource
+	Sanitize(target *unstructured.Unstructured, stripFields []string) error
+	// Fingerprint returns a hash of the copied content of the object, which changes whenever the target needs an update
+	Fingerprint(object *unstructured.Unstructured) (string, error)
+	// Compare returns true if the copied content of the actual target equals the expected target
+	Compare(expected *unstructured.Unstructured, actual *unstructured.Unstructured) bool
+}
+
+// ResourceHandlerRegistry holds the ResourceHandler of every kind with special copy semantics.
+// All other kinds are handled by the default ResourceHandler.
+type ResourceHandlerRegistry struct {
+	mutex          sync.RWMutex
+	handlers       map[schema.GroupKind]ResourceHandler
+	defaultHandler ResourceHandler
+}
+
+// NewResourceHandlerRegistry returns a registry with handlers for Secrets and ConfigMaps and UnstructuredHandler as default
+func NewResourceHandlerRegistry() *ResourceHandlerRegistry {
+	registry := &ResourceHandlerRegistry{
+		handlers:       map[schema.GroupKind]ResourceHandler{},
+		defaultHandler: &UnstructuredHandler{},
+	}
+	registry.Register(schema.GroupKind{Kind: "Secret"}, &SecretHandler{})
+	registry.Register(schema.GroupKind{Kind: "ConfigMap"}, &ConfigMapHandler{})
+	return registry
+}
+
+// Register sets the ResourceHandler of a kind, replacing any previously registered handler
+func (r *ResourceHandlerRegistry) Register(groupKind schema.GroupKind, handler ResourceHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers[groupKind] = handler
+}
+
+// SetDefault sets the ResourceHandler of all kinds without a registered handler
+func (r *ResourceHandlerRegistry) SetDefault(handler ResourceHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.defaultHandler = handler
+}
+
+// Get returns the ResourceHandler of a kind
+func (r *ResourceHandlerRegistry) Get(groupKind schema.GroupKind) ResourceHandler {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if handler, ok := r.handlers[groupKind]; ok {
+		return handler
+	}
+	return r.defaultHandler
+}
+
+// defaultStripFields are removed from every copied Resource as they are owned by the API server
+var defaultStripFields = []string{
+	"status",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.deletionTimestamp",
+	"metadata.deletionGracePeriodSeconds",
+	"metadata.selfLink",
+	"metadata.managedFields",
+	"metadata.ownerReferences",
+	"metadata.finalizers",
+}
+
+// exactFields hold the content of Secrets, ConfigMaps and similar kinds and have no server side defaults
+var exactFields = []string{"data", "binaryData", "stringData", "type"}
+
+// UnstructuredHandler copies any kind as unstructured object
+type UnstructuredHandler struct{}
+
+func (h *UnstructuredHandler) NewObject(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gvk)
+	return object
+}
+
+func (h *UnstructuredHandler) Clone(source *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return source.DeepCopy(), nil
+}
+
+func (h *UnstructuredHandler) Sanitize(target *unstructured.Unstructured, stripFields []string) error {
+	for _, field := range append(defaultStripFields, stripFields...) {
+		unstructured.RemoveNestedField(target.Object, strings.Split(field, ".")...)
+	}
+	return nil
+}
+
+func (h *UnstructuredHandler) Fingerprint(object *unstructured.Unstructured) (string, error) {
+	content := map[string]interface{}{}
+	for field, value := range object.Object {
+		if !isMetaField(field) {
+			content[field] = value
+		}
+	}
+	// Maps are marshalled with sorted keys, which makes the fingerprint stable
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Compare ignores metadata and status. Fields of the expected object which may be defaulted
+// by the API server only need to be contained in the actual object.
+func (h *UnstructuredHandler) Compare(expected *unstructured.Unstructured, actual *unstructured.Unstructured) bool {
+	for field, expectedValue := range expected.Object {
+		if isMetaField(field) {
+			continue
+		}
+		if containsString(exactFields, field) {
+			if !equality.Semantic.DeepEqual(expectedValue, actual.Object[field]) {
+				return false
+			}
+		} else if !isContained(expectedValue, actual.Object[field]) {
+			return false
+		}
+	}
+	for _, field := range exactFields {
+		if _, expectedFound := expected.Object[field]; !expectedFound {
+			if _, actualFound := actual.Object[field]; actualFound {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SecretHandler copies v1.Secrets and compares their type and data
+type SecretHandler struct {
+	UnstructuredHandler
+}
+
+func (h *SecretHandler) Compare(expected *unstructured.Unstructured, actual *unstructured.Unstructured) bool {
+	expectedSecret, actualSecret := &v1.Secret{}, &v1.Secret{}
+	if fromUnstructured(expected, expectedSecret) != nil || fromUnstructured(actual, actualSecret) != nil {
+		return false
+	}
+	return expectedSecret.Type == actualSecret.Type &&
+		equality.Semantic.DeepEqual(expectedSecret.Data, actualSecret.Data)
+}
+
+// ConfigMapHandler copies v1.ConfigMaps and compares their data and binary data
+type ConfigMapHandler struct {
+	UnstructuredHandler
+}
+
+func (h *ConfigMapHandler) Compare(expected *unstructured.Unstructured, actual *unstructured.Unstructured) bool {
+	expectedConfigMap, actualConfigMap := &v1.ConfigMap{}, &v1.ConfigMap{}
+	if fromUnstructured(expected, expectedConfigMap) != nil || fromUnstructured(actual, actualConfigMap) != nil {
+		return false
+	}
+	return equality.Semantic.DeepEqual(expectedConfigMap.Data, actualConfigMap.Data) &&
+		equality.Semantic.DeepEqual(expectedConfigMap.BinaryData, actualConfigMap.BinaryData)
+}
+
+func fromUnstructured(object *unstructured.Unstructured, typed interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed)
+}
+
+func isMetaField(field string) bool {
+	return field == "apiVersion" || field == "kind" || field == "metadata" || field == "status"
+}
+
+// isContained returns true if all fields of expected are set to the same values in actual,
+// items of lists are compared in order and must have the same length
+func isContained(expected interface{}, actual interface{}) bool {
+	if expectedList, isList := expected.([]interface{}); isList {
+		actualList, isList := actual.([]interface{})
+		if !isList || len(expectedList) != len(actualList) {
+			return false
+		}
+		for i := range expectedList {
+			if !isContained(expectedList[i], actualList[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	expectedMap, isMap := expected.(map[string]interface{})
+	if !isMap {
+		return equality.Semantic.DeepEqual(expected, actual)
+	}
+	actualMap, isMap := actual.(map[string]interface{})
+	if !isMap {
+		return false
+	}
+	for field, expectedValue := range expectedMap {
+		if !isContained(expectedValue, actualMap[field]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestResource(fields map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "route.openshift.io/v1",
+		"kind":       "Route",
+		"metadata":   map[string]interface{}{"namespace": "target", "name": "app"},
+	}}
+	for field, value := range fields {
+		object.Object[field] = value
+	}
+	return object
+}
+
+func TestIsContained(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected interface{}
+		actual   interface{}
+		want     bool
+	}{
+		{
+			name:     "equal values",
+			expected: "app",
+			actual:   "app",
+			want:     true,
+		},
+		{
+			name:     "different values",
+			expected: "app",
+			actual:   "other",
+		},
+		{
+			name:     "missing value",
+			expected: "app",
+		},
+		{
+			name:     "map with server added fields",
+			expected: map[string]interface{}{"host": "app.example.com"},
+			actual:   map[string]interface{}{"host": "app.example.com", "wildcardPolicy": "None"},
+			want:     true,
+		},
+		{
+			name:     "map with missing field",
+			expected: map[string]interface{}{"host": "app.example.com", "path": "/"},
+			actual:   map[string]interface{}{"host": "app.example.com"},
+		},
+		{
+			name:     "map compared to value",
+			expected: map[string]interface{}{"host": "app.example.com"},
+			actual:   "app.example.com",
+		},
+		{
+			name: "nested maps with server added fields",
+			expected: map[string]interface{}{
+				"to": map[string]interface{}{"kind": "Service", "name": "app"},
+			},
+			actual: map[string]interface{}{
+				"to": map[string]interface{}{"kind": "Service", "name": "app", "weight": int64(100)},
+			},
+			want: true,
+		},
+		{
+			name: "nested maps with changed field",
+			expected: map[string]interface{}{
+				"to": map[string]interface{}{"kind": "Service", "name": "app"},
+			},
+			actual: map[string]interface{}{
+				"to": map[string]interface{}{"kind": "Service", "name": "other"},
+			},
+		},
+		{
+			name:     "equal lists",
+			expected: []interface{}{"a", "b"},
+			actual:   []interface{}{"a", "b"},
+			want:     true,
+		},
+		{
+			name:     "lists in different order",
+			expected: []interface{}{"a", "b"},
+			actual:   []interface{}{"b", "a"},
+		},
+		{
+			name:     "list with additional item",
+			expected: []interface{}{"a"},
+			actual:   []interface{}{"a", "b"},
+		},
+		{
+			name: "list items with server added fields",
+			expected: []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:1"},
+			},
+			actual: []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:1", "imagePullPolicy": "IfNotPresent"},
+			},
+			want: true,
+		},
+		{
+			name: "list items with changed field",
+			expected: []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:1"},
+			},
+			actual: []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isContained(tt.expected, tt.actual); got != tt.want {
+				t.Errorf("isContained() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnstructuredHandlerCompare(t *testing.T) {
+	spec := map[string]interface{}{
+		"host": "app.example.com",
+		"to":   map[string]interface{}{"kind": "Service", "name": "app"},
+	}
+	tests := []struct {
+		name     string
+		expected map[string]interface{}
+		actual   map[string]interface{}
+		want     bool
+	}{
+		{
+			name:     "equal",
+			expected: map[string]interface{}{"spec": spec},
+			actual:   map[string]interface{}{"spec": spec},
+			want:     true,
+		},
+		{
+			name:     "ignores status",
+			expected: map[string]interface{}{"spec": spec},
+			actual:   map[string]interface{}{"spec": spec, "status": map[string]interface{}{"ingress": []interface{}{}}},
+			want:     true,
+		},
+		{
+			name:     "server defaulted spec fields",
+			expected: map[string]interface{}{"spec": spec},
+			actual: map[string]interface{}{"spec": map[string]interface{}{
+				"host":           "app.example.com",
+				"to":             map[string]interface{}{"kind": "Service", "name": "app", "weight": int64(100)},
+				"wildcardPolicy": "None",
+			}},
+			want: true,
+		},
+		{
+			name:     "modified spec",
+			expected: map[string]interface{}{"spec": spec},
+			actual: map[string]interface{}{"spec": map[string]interface{}{
+				"host": "other.example.com",
+				"to":   map[string]interface{}{"kind": "Service", "name": "app"},
+			}},
+		},
+		{
+			name:     "additional data keys",
+			expected: map[string]interface{}{"data": map[string]interface{}{"a": "1"}},
+			actual:   map[string]interface{}{"data": map[string]interface{}{"a": "1", "b": "2"}},
+		},
+		{
+			name:     "additional data field",
+			expected: map[string]interface{}{"spec": spec},
+			actual:   map[string]interface{}{"spec": spec, "data": map[string]interface{}{"a": "1"}},
+		},
+		{
+			name:     "changed type",
+			expected: map[string]interface{}{"type": "Opaque"},
+			actual:   map[string]interface{}{"type": "kubernetes.io/tls"},
+		},
+	}
+	handler := &UnstructuredHandler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := handler.Compare(newTestResource(tt.expected), newTestResource(tt.actual)); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// The Reasons of the CopyResource conditions
+const (
+	ReasonReady              = "Ready"
+	ReasonSourceFound        = "SourceFound"
+	ReasonSourceNotFound     = "SourceNotFound"
+	ReasonSourceNotGranted   = "SourceNotGranted"
+	ReasonSourceError        = "SourceError"
+	ReasonInvalidKind        = "InvalidKind"
+	ReasonTargetsSynced      = "TargetsSynced"
+	ReasonSyncFailed         = "SyncFailed"
+	ReasonInvalidTargets     = "InvalidTargets"
+	ReasonFinalizerFailed    = "FinalizerFailed"
+	ReasonNoConflict         = "NoConflict"
+	ReasonTargetConflict     = "TargetConflict"
+	ReasonNotReconciled      = "NotReconciled"
+	ReasonInvalidKeys        = "InvalidKeys"
+	ReasonKeysMapped         = "KeysMapped"
+	ReasonInvalidKeyMappings = "InvalidKeyMappings"
+	ReasonInvalidSources     = "InvalidSources"
+	ReasonMergeFailed        = "MergeFailed"
+	ReasonPolicyDenied       = "PolicyDenied"
+	ReasonPolicyAllowed      = "PolicyAllowed"
+	ReasonSourceOptedIn      = "SourceOptedIn"
+	ReasonSourceNotOptedIn   = "SourceNotOptedIn"
+)
+
+// setCondition sets a condition on the status, the LastTransitionTime only changes if the condition status changes
+func setCondition(status *resourcebaloisechv1alpha1.CopyResourceStatus, conditionType string, conditionStatus metav1.ConditionStatus, reason string, message string) {
+	condition := findCondition(status.Conditions, conditionType)
+	if condition == nil {
+		status.Conditions = append(status.Conditions, resourcebaloisechv1alpha1.Condition{Type: conditionType})
+		condition = &status.Conditions[len(status.Conditions)-1]
+	}
+	if condition.Status != conditionStatus {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = conditionStatus
+	condition.ObservedGeneration = status.ObservedGeneration
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// removeCondition removes a condition which does not apply anymore from the status
+func removeCondition(status *resourcebaloisechv1alpha1.CopyResourceStatus, conditionType string) {
+	var conditions []resourcebaloisechv1alpha1.Condition
+	for _, condition := range status.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	status.Conditions = conditions
+}
+
+func findCondition(conditions []resourcebaloisechv1alpha1.Condition, conditionType string) *resourcebaloisechv1alpha1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// readyDependencies determine the Ready condition, the first condition without its expected status in this order
+// makes the CopyResource not ready. Conditions which are not set yet only matter if they are required.
+var readyDependencies = []struct {
+	conditionType string
+	expected      metav1.ConditionStatus
+	required      bool
+}{
+	{resourcebaloisechv1alpha1.ConditionSourceFound, metav1.ConditionTrue, true},
+	{resourcebaloisechv1alpha1.ConditionKeysMapped, metav1.ConditionTrue, false},
+	{resourcebaloisechv1alpha1.ConditionConflict, metav1.ConditionFalse, false},
+	{resourcebaloisechv1alpha1.ConditionPolicyDenied, metav1.ConditionFalse, false},
+	{resourcebaloisechv1alpha1.ConditionSourceOptedIn, metav1.ConditionTrue, false},
+	{resourcebaloisechv1alpha1.ConditionTargetSynced, metav1.ConditionTrue, true},
+}
+
+// updateReadyCondition derives the Ready condition and the Message from all other conditions
+func updateReadyCondition(status *resourcebaloisechv1alpha1.CopyResourceStatus) {
+	for _, dependency := range readyDependencies {
+		condition := findCondition(status.Conditions, dependency.conditionType)
+		if condition == nil {
+			if dependency.required {
+				setCondition(status, resourcebaloisechv1alpha1.ConditionReady, metav1.ConditionUnknown, ReasonNotReconciled, dependency.conditionType+" is not known yet")
+				status.Message = dependency.conditionType + " is not known yet"
+				return
+			}
+			continue
+		}
+		if condition.Status != dependency.expected {
+			setCondition(status, resourcebaloisechv1alpha1.ConditionReady, metav1.ConditionFalse, condition.Reason, condition.Message)
+			status.Message = condition.Message
+			return
+		}
+	}
+	setCondition(status, resourcebaloisechv1alpha1.ConditionReady, metav1.ConditionTrue, ReasonReady, "Resource is copied to all targets")
+	status.Message = "Resource is copied to all targets"
+}
+
+// updateStatus writes the status of the CopyResource if it has changed
+func (r *CopyResourceReconciler) updateStatus(copyResource *resourcebaloisechv1alpha1.CopyResource, status *resourcebaloisechv1alpha1.CopyResourceStatus, log logr.Logger) error {
+	updateReadyCondition(status)
+	if reflect.DeepEqual(copyResource.Status, *status) {
+		return nil
+	}
+	copyResource.Status = *status
+	err := r.Status().Update(context.TODO(), copyResource)
+	if err != nil {
+		log.Error(err, "Failed to update CopyResource status.", "resourceVersion", copyResource.Status.ResourceVersion)
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// templateFuncs are the helpers available in the Transform templates in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	"b64enc": func(value string) string {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	},
+	"b64dec": func(value string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		return string(decoded), err
+	},
+	"fromJson": func(value string) (interface{}, error) {
+		var result interface{}
+		err := json.Unmarshal([]byte(value), &result)
+		return result, err
+	},
+	"fromYaml": func(value string) (interface{}, error) {
+		var result interface{}
+		err := yaml.Unmarshal([]byte(value), &result)
+		return result, err
+	},
+	"toJson": func(value interface{}) (string, error) {
+		raw, err := json.Marshal(value)
+		return string(raw), err
+	},
+	"toYaml": func(value interface{}) (string, error) {
+		raw, err := yaml.Marshal(value)
+		return string(raw), err
+	},
+	"field": func(path string, value interface{}) (interface{}, error) {
+		for _, name := range strings.Split(path, ".") {
+			fields, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("field %s not found", path)
+			}
+			if value, ok = fields[name]; !ok {
+				return nil, fmt.Errorf("field %s not found", path)
+			}
+		}
+		return value, nil
+	},
+	"join": func(separator string, values interface{}) (string, error) {
+		switch values := values.(type) {
+		case []string:
+			return strings.Join(values, separator), nil
+		case []interface{}:
+			parts := make([]string, len(values))
+			for i, value := range values {
+				parts[i] = fmt.Sprint(value)
+			}
+			return strings.Join(parts, separator), nil
+		}
+		return "", fmt.Errorf("join expects a list, got %T", values)
+	},
+	"split": func(separator string, value string) []string {
+		return strings.Split(value, separator)
+	},
+	"default": func(defaultValue string, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return defaultValue
+		}
+		return value
+	},
+}
+
+// templateContext is the data a Transform template is rendered with
+type templateContext struct {
+	// Data holds all keys of the source with decoded values
+	Data map[string]string
+	// Metadata holds the metadata of the source
+	Metadata templateMetadata
+}
+
+type templateMetadata struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// parseTemplates parses the Transform templates of every target key, missing keys of the source render empty
+func parseTemplates(transform map[string]string) (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+	for key, text := range transform {
+		parsed, err := template.New(key).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of key %s: %v", key, err)
+		}
+		templates[key] = parsed
+	}
+	return templates, nil
+}
+
+// newTemplateContext returns the context of the source object, the data of Secrets and binary data are base64 decoded
+func newTemplateContext(source *unstructured.Unstructured) (*templateContext, error) {
+	values := &templateContext{
+		Data: map[string]string{},
+		Metadata: templateMetadata{
+			Name:        source.GetName(),
+			Namespace:   source.GetNamespace(),
+			Labels:      source.GetLabels(),
+			Annotations: source.GetAnnotations(),
+		},
+	}
+	for _, field := range dataFields {
+		data, ok := source.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		encoded := isEncoded(source, field)
+		for key, value := range data {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if encoded {
+				decoded, err := base64.StdEncoding.DecodeString(text)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode %s key %s: %v", field, key, err)
+				}
+				text = string(decoded)
+			}
+			values.Data[key] = text
+		}
+	}
+	return values, nil
+}
+
+// renderTemplates writes the rendered templates to the data of the target object, replacing existing keys
+func renderTemplates(target *unstructured.Unstructured, templates map[string]*template.Template, values *templateContext) error {
+	if len(templates) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(templates))
+	for key := range templates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data, ok := target.Object["data"].(map[string]interface{})
+	if !ok {
+		data = map[string]interface{}{}
+	}
+	for _, key := range keys {
+		var rendered bytes.Buffer
+		err := templates[key].Execute(&rendered, values)
+		if err != nil {
+			return fmt.Errorf("failed to render key %s: %v", key, err)
+		}
+		for _, field := range dataFields {
+			if otherData, ok := target.Object[field].(map[string]interface{}); ok {
+				delete(otherData, key)
+			}
+		}
+		if target.GetKind() == "Secret" {
+			data[key] = base64.StdEncoding.EncodeToString(rendered.Bytes())
+		} else {
+			data[key] = rendered.String()
+		}
+	}
+	target.Object["data"] = data
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	source := newTestObject("Secret", "database", "1", map[string]interface{}{
+		"data": map[string]interface{}{
+			"username": encode("app"),
+			"config":   encode(`{"db": {"host": "db.example.com", "port": 5432}, "replicas": ["a", "b"]}`),
+			"hosts":    encode("a.example.com,b.example.com"),
+			"empty":    encode(""),
+		},
+	})
+	source.SetLabels(map[string]string{"team": "platform"})
+
+	tests := []struct {
+		name      string
+		kind      string
+		transform map[string]string
+		want      map[string]interface{}
+		wantErr   string
+	}{
+		{
+			name:      "data and metadata",
+			transform: map[string]string{"user": "{{ .Data.username }}@{{ .Metadata.Namespace }}/{{ .Metadata.Name }} {{ .Metadata.Labels.team }}"},
+			want:      map[string]interface{}{"user": "app@source/database platform"},
+		},
+		{
+			name:      "field of parsed JSON",
+			transform: map[string]string{"host": `{{ fromJson .Data.config | field "db.host" }}:{{ fromJson .Data.config | field "db.port" }}`},
+			want:      map[string]interface{}{"host": "db.example.com:5432"},
+		},
+		{
+			name:      "missing field of parsed JSON",
+			transform: map[string]string{"host": `{{ fromJson .Data.config | field "db.user" }}`},
+			wantErr:   "field db.user not found",
+		},
+		{
+			name:      "field of parsed YAML",
+			transform: map[string]string{"host": `{{ fromYaml .Data.config | field "db.host" }}`},
+			want:      map[string]interface{}{"host": "db.example.com"},
+		},
+		{
+			name:      "join",
+			transform: map[string]string{"replicas": `{{ fromJson .Data.config | field "replicas" | join ";" }}`},
+			want:      map[string]interface{}{"replicas": "a;b"},
+		},
+		{
+			name:      "join of no list",
+			transform: map[string]string{"replicas": `{{ join ";" .Data.username }}`},
+			wantErr:   "join expects a list, got string",
+		},
+		{
+			name:      "split",
+			transform: map[string]string{"first": `{{ index (split "," .Data.hosts) 0 }}`, "hosts": `{{ split "," .Data.hosts | join " " }}`},
+			want:      map[string]interface{}{"first": "a.example.com", "hosts": "a.example.com b.example.com"},
+		},
+		{
+			name:      "default of missing and empty keys",
+			transform: map[string]string{"password": `{{ default "changeit" .Data.password }}`, "empty": `{{ default "none" .Data.empty }}`},
+			want:      map[string]interface{}{"password": "changeit", "empty": "none"},
+		},
+		{
+			name:      "default of existing key",
+			transform: map[string]string{"user": `{{ default "admin" .Data.username }}`},
+			want:      map[string]interface{}{"user": "app"},
+		},
+		{
+			name:      "missing key renders empty",
+			transform: map[string]string{"password": "{{ .Data.password }}"},
+			want:      map[string]interface{}{"password": ""},
+		},
+		{
+			name:      "b64enc and b64dec",
+			transform: map[string]string{"encoded": "{{ b64enc .Data.username }}", "decoded": `{{ b64dec "YXBw" }}`},
+			want:      map[string]interface{}{"encoded": encode("app"), "decoded": "app"},
+		},
+		{
+			name:      "b64dec of invalid base64",
+			transform: map[string]string{"decoded": `{{ b64dec "!" }}`},
+			wantErr:   "failed to render key decoded",
+		},
+		{
+			name:      "toJson",
+			transform: map[string]string{"db": `{{ fromJson .Data.config | field "db" | toJson }}`},
+			want:      map[string]interface{}{"db": `{"host":"db.example.com","port":5432}`},
+		},
+		{
+			name:      "Secret targets are encoded",
+			kind:      "Secret",
+			transform: map[string]string{"user": "{{ .Data.username }}"},
+			want:      map[string]interface{}{"user": encode("app")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := tt.kind
+			if kind == "" {
+				kind = "ConfigMap"
+			}
+			copyResource := &resourcebaloisechv1alpha1.CopyResource{Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+				IncludeKeys: []string{"none"},
+				Transform:   tt.transform,
+			}}
+			processor, err := newDataProcessor(copyResource, schema.GroupVersionKind{Version: "v1", Kind: kind})
+			if err != nil {
+				t.Fatalf("newDataProcessor() error = %v", err)
+			}
+			target := source.DeepCopy()
+			err = processor.process(target)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("process() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("process() error = %v", err)
+			}
+			if !reflect.DeepEqual(target.Object["data"], tt.want) {
+				t.Errorf("data = %v, want %v", target.Object["data"], tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform map[string]string
+		target    schema.GroupVersionKind
+		wantErr   string
+	}{
+		{
+			name:      "valid template",
+			transform: map[string]string{"url": "{{ .Data.host }}"},
+			target:    schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		},
+		{
+			name:      "invalid template",
+			transform: map[string]string{"url": "{{ .Data.host "},
+			target:    schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			wantErr:   "invalid template of key url",
+		},
+		{
+			name:      "unknown function",
+			transform: map[string]string{"url": "{{ upper .Data.host }}"},
+			target:    schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			wantErr:   `function "upper" not defined`,
+		},
+		{
+			name:      "unsupported target kind",
+			transform: map[string]string{"url": "{{ .Data.host }}"},
+			target:    schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"},
+			wantErr:   "transform is only supported for Secrets and ConfigMaps, not Route",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copyResource := &resourcebaloisechv1alpha1.CopyResource{Spec: resourcebaloisechv1alpha1.CopyResourceSpec{Transform: tt.transform}}
+			_, err := newDataProcessor(copyResource, tt.target)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("newDataProcessor() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("newDataProcessor() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
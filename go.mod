@@ -4,13 +4,13 @@ go 1.13
 
 require (
 	github.com/go-logr/logr v0.1.0
-	github.com/jinzhu/copier v0.3.2
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.8.1
-	github.com/prometheus/common v0.4.1
+	github.com/prometheus/client_golang v1.0.0
 	go.uber.org/zap v1.10.0
 	k8s.io/api v0.18.2
 	k8s.io/apimachinery v0.18.2
 	k8s.io/client-go v0.18.2
 	sigs.k8s.io/controller-runtime v0.6.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -29,9 +29,11 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
 	"github.com/baloise/os3-copier/controllers"
+	"github.com/baloise/os3-copier/webhooks"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -57,6 +59,10 @@ func main() {
 	var healtAddr string
 	var enableLeaderElection bool
 	var devModeEnabled bool
+	var targetEventsEnabled bool
+	var webhooksEnabled bool
+	var sourceOptInRequired bool
+	var annotationsEnabled bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&healtAddr, "probe-addr", ":8081", "The address the health check endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
@@ -64,6 +70,15 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&devModeEnabled, "dev-mode-enabled", false,
 		"Enable dev mode to see DEBUG logs and stack traces. ")
+	flag.BoolVar(&targetEventsEnabled, "target-events-enabled", false,
+		"Record events on the target resources in addition to the CopyResource. ")
+	flag.BoolVar(&webhooksEnabled, "webhooks-enabled", false,
+		"Serve the admission webhooks, which require a serving certificate. ")
+	flag.BoolVar(&sourceOptInRequired, "source-opt-in-required", false,
+		"Only copy source resources to the target namespaces listed in their copier.baloise.ch/allowed-targets annotation. ")
+	flag.BoolVar(&annotationsEnabled, "annotations-enabled", false,
+		"Copy Secrets and ConfigMaps annotated with copier.baloise.ch/copy-to without a CopyResource, "+
+			"only to target namespaces explicitly allowed by a CopyPolicy. ")
 	flag.Parse()
 
 	var stacktraceLevel zapcore.LevelEnabler
@@ -104,13 +119,45 @@ func main() {
 	}
 
 	if err = (&controllers.CopyResourceReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CopyResource"),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Log:                 ctrl.Log.WithName("controllers").WithName("CopyResource"),
+		Scheme:              mgr.GetScheme(),
+		Handlers:            controllers.NewResourceHandlerRegistry(),
+		Recorder:            mgr.GetEventRecorderFor("os3-copier"),
+		TargetEventsEnabled: targetEventsEnabled,
+		SourceOptInRequired: sourceOptInRequired,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CopyResource")
 		os.Exit(1)
 	}
+	if annotationsEnabled {
+		if err = (&controllers.AnnotationReconciler{
+			Client:   mgr.GetClient(),
+			Log:      ctrl.Log.WithName("controllers").WithName("Annotation"),
+			Handlers: controllers.NewResourceHandlerRegistry(),
+			Recorder: mgr.GetEventRecorderFor("os3-copier"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Annotation")
+			os.Exit(1)
+		}
+	}
+	if err = mgr.Add(&controllers.OrphanCollector{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Log:       ctrl.Log.WithName("controllers").WithName("OrphanCollector"),
+		Interval:  syncPeriod,
+	}); err != nil {
+		setupLog.Error(err, "unable to create orphan collector")
+		os.Exit(1)
+	}
+	if webhooksEnabled {
+		mgr.GetWebhookServer().Register(webhooks.DefaultCopyResourcePath, &webhook.Admission{Handler: &webhooks.CopyResourceDefaulter{}})
+		mgr.GetWebhookServer().Register(webhooks.ValidateCopyResourcePath, &webhook.Admission{Handler: &webhooks.CopyResourceValidator{
+			Client:     mgr.GetClient(),
+			RESTMapper: mgr.GetRESTMapper(),
+			Log:        ctrl.Log.WithName("webhooks").WithName("CopyResourceValidator"),
+		}})
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
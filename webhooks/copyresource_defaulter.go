@@ -0,0 +1,70 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+	"github.com/baloise/os3-copier/controllers"
+)
+
+// DefaultCopyResourcePath is the path the CopyResourceDefaulter is served on
+const DefaultCopyResourcePath = "/mutate-resource-baloise-ch-v1alpha1-copyresource"
+
+// +kubebuilder:webhook:path=/mutate-resource-baloise-ch-v1alpha1-copyresource,mutating=true,failurePolicy=fail,groups=resource.baloise.ch,resources=copyresources,verbs=create;update,versions=v1alpha1,name=mcopyresource.kb.io
+
+// CopyResourceDefaulter materializes the defaults of the target name and the policies in the spec of CopyResources
+type CopyResourceDefaulter struct {
+	decoder *admission.Decoder
+}
+
+// InjectDecoder is called by the webhook server to inject the decoder of the managers scheme
+func (d *CopyResourceDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+func (d *CopyResourceDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{}
+	err := d.decoder.Decode(req, copyResource)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !copyResource.GetDeletionTimestamp().IsZero() {
+		return admission.Allowed("CopyResource is being deleted")
+	}
+
+	// The namespace and name are not yet set on objects being created
+	if copyResource.Namespace == "" {
+		copyResource.Namespace = req.Namespace
+	}
+	if copyResource.Name == "" {
+		copyResource.Name = req.Name
+	}
+	controllers.SetDefaults(copyResource)
+
+	raw, err := json.Marshal(copyResource)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, raw)
+}
@@ -0,0 +1,110 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+func TestCopyResourceDefaulter(t *testing.T) {
+	tests := []struct {
+		name         string
+		objectName   string
+		generateName string
+		targetName   string
+		wantPatches  map[string]interface{}
+	}{
+		{
+			name:       "target name derives from the name",
+			objectName: "registry",
+			wantPatches: map[string]interface{}{
+				"/spec/apiVersion":     "v1",
+				"/spec/targetName":     "team-registry",
+				"/spec/deletionPolicy": "Orphan",
+				"/spec/conflictPolicy": "Fail",
+			},
+		},
+		{
+			name:       "target name is kept",
+			objectName: "registry",
+			targetName: "pull-secret",
+			wantPatches: map[string]interface{}{
+				"/spec/apiVersion":     "v1",
+				"/spec/deletionPolicy": "Orphan",
+				"/spec/conflictPolicy": "Fail",
+			},
+		},
+		{
+			name:         "target name is not set for generated names",
+			generateName: "registry-",
+			wantPatches: map[string]interface{}{
+				"/spec/apiVersion":     "v1",
+				"/spec/deletionPolicy": "Orphan",
+				"/spec/conflictPolicy": "Fail",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder, _ := admission.NewDecoder(newTestScheme())
+			defaulter := &CopyResourceDefaulter{}
+			_ = defaulter.InjectDecoder(decoder)
+
+			copyResource := &resourcebaloisechv1alpha1.CopyResource{
+				TypeMeta:   metav1.TypeMeta{APIVersion: resourcebaloisechv1alpha1.GroupVersion.String(), Kind: "CopyResource"},
+				ObjectMeta: metav1.ObjectMeta{Name: tt.objectName, GenerateName: tt.generateName},
+				Spec: resourcebaloisechv1alpha1.CopyResourceSpec{
+					Kind:            "Secret",
+					SourceNamespace: "source",
+					MetaName:        "registry",
+					TargetNamespace: "team-a",
+					TargetName:      tt.targetName,
+				},
+			}
+			req := newTestRequest(t, admissionv1beta1.Create, copyResource, nil)
+			req.Name = tt.objectName
+			response := defaulter.Handle(context.TODO(), req)
+
+			if !response.Allowed {
+				t.Fatalf("Handle() denied: %+v", response.Result)
+			}
+			patches := map[string]interface{}{}
+			for _, patch := range response.Patches {
+				patches[patch.Path] = patch.Value
+			}
+			for path, value := range tt.wantPatches {
+				if patches[path] != value {
+					t.Errorf("patch %s = %v, want %v", path, patches[path], value)
+				}
+			}
+			for _, path := range []string{"/spec/targetName", "/spec/targetKind"} {
+				if _, found := tt.wantPatches[path]; !found {
+					if value, found := patches[path]; found {
+						t.Errorf("unexpected patch %s = %v", path, value)
+					}
+				}
+			}
+		})
+	}
+}
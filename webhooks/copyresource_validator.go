@@ -0,0 +1,239 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+	"github.com/baloise/os3-copier/controllers"
+)
+
+// ValidateCopyResourcePath is the path the CopyResourceValidator is served on
+const ValidateCopyResourcePath = "/validate-resource-baloise-ch-v1alpha1-copyresource"
+
+// +kubebuilder:webhook:path=/validate-resource-baloise-ch-v1alpha1-copyresource,mutating=false,failurePolicy=fail,groups=resource.baloise.ch,resources=copyresources,verbs=create;update,versions=v1alpha1,name=vcopyresource.kb.io
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// CopyResourceValidator rejects CopyResources which would let the operator write target Resources
+// the requesting user is not allowed to write, as the operator writes them with its own privileges
+type CopyResourceValidator struct {
+	Client     client.Client
+	RESTMapper meta.RESTMapper
+	Log        logr.Logger
+	decoder    *admission.Decoder
+}
+
+// InjectDecoder is called by the webhook server to inject the decoder of the managers scheme
+func (v *CopyResourceValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+func (v *CopyResourceValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{}
+	err := v.decoder.Decode(req, copyResource)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	log := v.Log.WithValues("CopyResource", req.Namespace+"/"+req.Name, "user", req.UserInfo.Username)
+
+	// Updates which don't change the spec, e.g. of finalizers and status, are not checked again
+	if len(req.OldObject.Raw) > 0 {
+		oldCopyResource := &resourcebaloisechv1alpha1.CopyResource{}
+		err = v.decoder.DecodeRaw(req.OldObject, oldCopyResource)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if reflect.DeepEqual(oldCopyResource.Spec, copyResource.Spec) {
+			return admission.Allowed("spec unchanged")
+		}
+	}
+	if !copyResource.GetDeletionTimestamp().IsZero() {
+		return admission.Allowed("CopyResource is being deleted")
+	}
+
+	gvk, err := controllers.GetTargetGroupVersionKind(copyResource)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	err = controllers.ValidateKeys(copyResource)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	err = controllers.ValidateTargets(copyResource)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	if copyResource.Spec.TargetNamespaceSelector != nil {
+		_, err = metav1.LabelSelectorAsSelector(copyResource.Spec.TargetNamespaceSelector)
+		if err != nil {
+			return admission.Denied(fmt.Sprintf("invalid targetNamespaceSelector: %v", err))
+		}
+	}
+	mapping, err := v.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return admission.Denied(fmt.Sprintf("unknown target kind %s: %v", gvk.String(), err))
+	}
+
+	copyPolicies, err := controllers.ListCopyPolicies(ctx, v.Client)
+	if err != nil {
+		log.Error(err, "Failed to list CopyPolicies.")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	policyNamespaces, err := v.getPolicyNamespaces(ctx, copyResource)
+	if err != nil {
+		log.Error(err, "Failed to resolve target namespaces.")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if denials := controllers.EvaluatePolicies(copyPolicies, copyResource, policyNamespaces); len(denials) > 0 {
+		var messages []string
+		for _, denial := range denials {
+			messages = append(messages, denial.String())
+		}
+		log.Info("CopyResource denied by CopyPolicies.", "denials", messages)
+		return admission.Denied(strings.Join(messages, "; "))
+	}
+
+	verbs := []string{"create"}
+	if copyResource.Spec.ConflictPolicy == resourcebaloisechv1alpha1.ConflictPolicyAdopt ||
+		copyResource.Spec.ConflictPolicy == resourcebaloisechv1alpha1.ConflictPolicyOverwrite {
+		verbs = append(verbs, "update")
+	}
+
+	var denied []string
+	for _, namespace := range getTargetNamespaces(copyResource) {
+		for _, verb := range verbs {
+			allowed, err := v.isAllowed(ctx, req, mapping.Resource, namespace, verb)
+			if err != nil {
+				log.Error(err, "SubjectAccessReview failed.")
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+			if !allowed {
+				denied = append(denied, fmt.Sprintf("%s %s in %s", verb, mapping.Resource.Resource, describeNamespace(namespace)))
+			}
+		}
+	}
+	if len(denied) > 0 {
+		log.Info("CopyResource denied.", "denied", denied)
+		return admission.Denied(fmt.Sprintf("user %s may not %s", req.UserInfo.Username, strings.Join(denied, ", ")))
+	}
+	return admission.Allowed("")
+}
+
+// isAllowed asks the API server if the requesting user may perform verb on the resource in namespace
+func (v *CopyResourceValidator) isAllowed(ctx context.Context, req admission.Request, resource schema.GroupVersionResource, namespace string, verb string) (bool, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range req.UserInfo.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     resource.Group,
+				Version:   resource.Version,
+				Resource:  resource.Resource,
+			},
+			User:   req.UserInfo.Username,
+			Groups: req.UserInfo.Groups,
+			UID:    req.UserInfo.UID,
+			Extra:  extra,
+		},
+	}
+	err := v.Client.Create(ctx, review)
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// getTargetNamespaces returns the namespaces the requesting user needs access to.
+// Namespaces matching the TargetNamespaceSelector may be created later on,
+// so a selector requires access to all namespaces, which is checked with the empty namespace.
+func getTargetNamespaces(copyResource *resourcebaloisechv1alpha1.CopyResource) []string {
+	namespaces := getExplicitTargetNamespaces(copyResource)
+	if copyResource.Spec.TargetNamespaceSelector != nil {
+		namespaces = append(namespaces, "")
+	}
+	return namespaces
+}
+
+// getExplicitTargetNamespaces returns the namespaces set by TargetNamespace and TargetNamespaces
+func getExplicitTargetNamespaces(copyResource *resourcebaloisechv1alpha1.CopyResource) []string {
+	var namespaces []string
+	for _, namespace := range append([]string{copyResource.Spec.TargetNamespace}, copyResource.Spec.TargetNamespaces...) {
+		if namespace != "" && !containsString(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// getPolicyNamespaces returns the explicit target namespaces and the namespaces currently matching the
+// TargetNamespaceSelector. Namespaces matching later on are checked by the controller.
+func (v *CopyResourceValidator) getPolicyNamespaces(ctx context.Context, copyResource *resourcebaloisechv1alpha1.CopyResource) ([]string, error) {
+	namespaces := getExplicitTargetNamespaces(copyResource)
+	if copyResource.Spec.TargetNamespaceSelector == nil {
+		return namespaces, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(copyResource.Spec.TargetNamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaceList := &v1.NamespaceList{}
+	err = v.Client.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaceList.Items {
+		if !containsString(namespaces, namespace.Name) {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+	return namespaces, nil
+}
+
+func describeNamespace(namespace string) string {
+	if namespace == "" {
+		return "all namespaces"
+	}
+	return "namespace " + namespace
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	resourcebaloisechv1alpha1 "github.com/baloise/os3-copier/api/v1alpha1"
+)
+
+// reviewClient answers SubjectAccessReviews from a fixed set of allowed "verb namespace" pairs and records them
+type reviewClient struct {
+	client.Client
+	allowed []string
+	reviews []string
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	attributes := review.Spec.ResourceAttributes
+	request := attributes.Verb + " " + attributes.Namespace
+	c.reviews = append(c.reviews, request)
+	review.Status.Allowed = review.Spec.User == "alice" && attributes.Resource == "secrets" && containsString(c.allowed, request)
+	return nil
+}
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = resourcebaloisechv1alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func newTestCopyResource(spec resourcebaloisechv1alpha1.CopyResourceSpec) *resourcebaloisechv1alpha1.CopyResource {
+	copyResource := &resourcebaloisechv1alpha1.CopyResource{
+		TypeMeta:   metav1.TypeMeta{APIVersion: resourcebaloisechv1alpha1.GroupVersion.String(), Kind: "CopyResource"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "registry"},
+		Spec:       spec,
+	}
+	copyResource.Spec.Kind = "Secret"
+	copyResource.Spec.SourceNamespace = "source"
+	copyResource.Spec.MetaName = "registry"
+	copyResource.Spec.TargetName = "registry"
+	return copyResource
+}
+
+func newTestRequest(t *testing.T, operation admissionv1beta1.Operation, object runtime.Object, oldObject runtime.Object) admission.Request {
+	req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: operation,
+		Namespace: "team",
+		Name:      "registry",
+		UserInfo:  authenticationv1.UserInfo{Username: "alice"},
+	}}
+	var err error
+	req.Object.Raw, err = json.Marshal(object)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if oldObject != nil {
+		req.OldObject.Raw, err = json.Marshal(oldObject)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+	}
+	return req
+}
+
+func TestCopyResourceValidator(t *testing.T) {
+	protectKubeNamespaces := &resourcebaloisechv1alpha1.CopyPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "protect"},
+		Spec: resourcebaloisechv1alpha1.CopyPolicySpec{
+			Deny: []resourcebaloisechv1alpha1.CopyPolicyRule{{TargetNamespaces: []string{"kube-*"}}},
+		},
+	}
+	kubeSystem := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", Labels: map[string]string{"tier": "system"}}}
+	teamA := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tier": "team"}}}
+	systemSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "system"}}
+	teamSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "team"}}
+
+	tests := []struct {
+		name        string
+		spec        resourcebaloisechv1alpha1.CopyResourceSpec
+		oldSpec     *resourcebaloisechv1alpha1.CopyResourceSpec
+		objects     []runtime.Object
+		allowed     []string
+		want        bool
+		wantMessage string
+		wantReviews []string
+	}{
+		{
+			name:        "create in every target namespace",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a", TargetNamespaces: []string{"team-b", "team-a"}},
+			allowed:     []string{"create team-a", "create team-b"},
+			want:        true,
+			wantReviews: []string{"create team-a", "create team-b"},
+		},
+		{
+			name:        "denied create",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespaces: []string{"team-a", "team-b"}},
+			allowed:     []string{"create team-a"},
+			wantMessage: "user alice may not create secrets in namespace team-b",
+			wantReviews: []string{"create team-a", "create team-b"},
+		},
+		{
+			name:        "update is required to adopt",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a", ConflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyAdopt},
+			allowed:     []string{"create team-a"},
+			wantMessage: "user alice may not update secrets in namespace team-a",
+			wantReviews: []string{"create team-a", "update team-a"},
+		},
+		{
+			name:        "update is required to overwrite",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a", ConflictPolicy: resourcebaloisechv1alpha1.ConflictPolicyOverwrite},
+			allowed:     []string{"create team-a", "update team-a"},
+			want:        true,
+			wantReviews: []string{"create team-a", "update team-a"},
+		},
+		{
+			name:        "selector requires access to all namespaces",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a", TargetNamespaceSelector: teamSelector},
+			objects:     []runtime.Object{teamA},
+			allowed:     []string{"create team-a"},
+			wantMessage: "user alice may not create secrets in all namespaces",
+			wantReviews: []string{"create team-a", "create "},
+		},
+		{
+			name:    "unchanged spec is not checked again",
+			spec:    resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a"},
+			oldSpec: &resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a"},
+			want:    true,
+		},
+		{
+			name:        "changed spec is checked",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-b"},
+			oldSpec:     &resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "team-a"},
+			wantMessage: "user alice may not create secrets in namespace team-b",
+			wantReviews: []string{"create team-b"},
+		},
+		{
+			name:        "policy denies explicit namespace",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespaces: []string{"team-a", "kube-system"}},
+			objects:     []runtime.Object{protectKubeNamespaces},
+			allowed:     []string{"create team-a", "create kube-system"},
+			wantMessage: "kube-system: Secret source/registry is denied by CopyPolicy protect",
+		},
+		{
+			name:        "policy denies explicit namespace along with a selector",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespace: "kube-system", TargetNamespaceSelector: teamSelector},
+			objects:     []runtime.Object{protectKubeNamespaces, teamA},
+			allowed:     []string{"create kube-system", "create "},
+			wantMessage: "kube-system: Secret source/registry is denied by CopyPolicy protect",
+		},
+		{
+			name:        "policy denies selected namespace",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespaceSelector: systemSelector},
+			objects:     []runtime.Object{protectKubeNamespaces, kubeSystem, teamA},
+			allowed:     []string{"create "},
+			wantMessage: "kube-system: Secret source/registry is denied by CopyPolicy protect",
+		},
+		{
+			name:        "policy permits selected namespaces",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespaceSelector: teamSelector},
+			objects:     []runtime.Object{protectKubeNamespaces, kubeSystem, teamA},
+			allowed:     []string{"create "},
+			want:        true,
+			wantReviews: []string{"create "},
+		},
+		{
+			name:        "no target namespace",
+			spec:        resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespaces: []string{""}},
+			wantMessage: "no target namespace set",
+		},
+		{
+			name: "invalid selector",
+			spec: resourcebaloisechv1alpha1.CopyResourceSpec{TargetNamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Like"}},
+			}},
+			wantMessage: "invalid targetNamespaceSelector",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := newTestScheme()
+			decoder, _ := admission.NewDecoder(scheme)
+			restMapper := meta.NewDefaultRESTMapper(nil)
+			restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+			reviewer := &reviewClient{Client: fake.NewFakeClientWithScheme(scheme, tt.objects...), allowed: tt.allowed}
+			validator := &CopyResourceValidator{Client: reviewer, RESTMapper: restMapper, Log: logf.NullLogger{}}
+			_ = validator.InjectDecoder(decoder)
+
+			operation := admissionv1beta1.Create
+			var oldObject runtime.Object
+			if tt.oldSpec != nil {
+				operation = admissionv1beta1.Update
+				oldObject = newTestCopyResource(*tt.oldSpec)
+			}
+			response := validator.Handle(context.TODO(), newTestRequest(t, operation, newTestCopyResource(tt.spec), oldObject))
+
+			if response.Allowed != tt.want {
+				t.Errorf("Handle() allowed = %v, want %v, result %+v", response.Allowed, tt.want, response.Result)
+			}
+			if tt.wantMessage != "" && !strings.Contains(string(response.Result.Reason), tt.wantMessage) {
+				t.Errorf("Handle() reason = %q, want %q", response.Result.Reason, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(reviewer.reviews, tt.wantReviews) {
+				t.Errorf("SubjectAccessReviews = %q, want %q", reviewer.reviews, tt.wantReviews)
+			}
+		})
+	}
+}